@@ -15,16 +15,30 @@ import (
 	"github.com/gorilla/mux"
 
 	_ "github.com/maoqide/kubeutil/initialize"
+	"github.com/maoqide/kubeutil/pkg/audit"
+	"github.com/maoqide/kubeutil/pkg/auth"
+	"github.com/maoqide/kubeutil/pkg/client"
 	"github.com/maoqide/kubeutil/pkg/copy"
 	"github.com/maoqide/kubeutil/pkg/kube"
 )
 
 var (
 	addr = flag.String("addr", ":8091", "http service address")
+
+	impersonate = flag.Bool("impersonate", false, "make kubernetes api requests as the authenticated user, requires impersonate permission")
+
+	authOptions  auth.Options
+	authorizer   auth.Authorizer
+	auditOptions audit.Options
+	auditor      *audit.Logger
 )
 
+func init() {
+	authOptions.AddFlags(flag.CommandLine)
+	auditOptions.AddFlags(flag.CommandLine)
+}
+
 func serveFile(w http.ResponseWriter, r *http.Request) {
-	// auth
 	if r.Method != "GET" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -45,8 +59,20 @@ func download(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	// copy is done by exec tar in container.
+	attrs := auth.Attributes{Verb: "create", Resource: "pods", Subresource: "exec", Namespace: namespace, Name: podName}
+	if err := auth.Authorize(r.Context(), authorizer, attrs); err != nil {
+		log.Printf("download denied: %v\n", err)
+		event := audit.FromRequest(r, audit.AuthorizationDenied)
+		event.Namespace, event.Pod, event.Container, event.Path = namespace, podName, containerName, file
+		event.Action = "download"
+		event.Reason = err.Error()
+		auditor.Log(event)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 
-	client, err := kube.GetClient()
+	client, err := kube.GetRequestClient(r.Context(), *impersonate)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -59,12 +85,31 @@ func download(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.tar", fileName))
-	io.Copy(w, reader)
-	return
+	n, err := io.Copy(w, reader)
+	event := audit.FromRequest(r, audit.FileDownload)
+	event.Namespace, event.Pod, event.Container, event.Path, event.Bytes = namespace, podName, containerName, file, n
+	if err != nil {
+		event.Reason = err.Error()
+	}
+	auditor.Log(event)
 }
 
 func main() {
+	flag.Parse()
+	authenticator, err := authOptions.Authenticator(*client.Clientset())
+	if err != nil {
+		log.Fatalf("setup authentication err: %v", err)
+	}
+	authorizer, err = authOptions.Authorizer(*client.Clientset())
+	if err != nil {
+		log.Fatalf("setup authorization err: %v", err)
+	}
+	auditor, err = auditOptions.Logger()
+	if err != nil {
+		log.Fatalf("setup audit err: %v", err)
+	}
 	router := mux.NewRouter()
+	router.Use(auth.Middleware(authenticator))
 	router.PathPrefix("/debug/pprof/").Handler(http.DefaultServeMux)
 	router.HandleFunc("/file", serveFile)
 	// http://127.0.0.1:8091/copy/default/nginx-deployment-8d8d4dc86-sqfcx/nginx/download?file=/root/sss
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/maoqide/kubeutil/pkg/audit"
+	terminal "github.com/maoqide/kubeutil/pkg/terminal"
+)
+
+// adminOnly allow only requests from users in admin group.
+func adminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// serveAdminSessions list live terminal sessions.
+func serveAdminSessions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(terminal.DefaultRegistry.List())
+}
+
+// serveAdminSession get live terminal session, or force close it by DELETE.
+func serveAdminSession(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	info, ok := terminal.DefaultRegistry.Info(id)
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		log.Printf("admin close session: %s, %s/%s/%s, user: %s\n", id, info.Namespace, info.Pod, info.Container, info.User)
+		event := audit.FromRequest(r, audit.SessionClose)
+		event.SessionID, event.Namespace, event.Pod, event.Container, event.Node = id, info.Namespace, info.Pod, info.Container, info.Node
+		event.Reason = "closed by admin, session user: " + info.User
+		auditor.Log(event)
+		if err := terminal.DefaultRegistry.Close(id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/maoqide/kubeutil/pkg/audit"
+	"github.com/maoqide/kubeutil/pkg/auth"
+	wsterminal "github.com/maoqide/kubeutil/pkg/terminal/websocket"
+)
+
+// authorizer authorize requests authenticated by auth.Middleware
+var authorizer auth.Authorizer
+
+// authorize check whether user of r could perform attrs, deny the request if not.
+func authorize(w http.ResponseWriter, r *http.Request, attrs ...auth.Attributes) bool {
+	for _, a := range attrs {
+		if err := auth.Authorize(r.Context(), authorizer, a); err != nil {
+			log.Printf("%s %s denied: %v\n", r.Method, r.URL.Path, err)
+			auditor.Log(deniedEvent(r, a, err))
+			wsterminal.Deny(w, r, err.Error())
+			return false
+		}
+	}
+	return true
+}
+
+// deniedEvent audit event of request r denied to perform attrs.
+func deniedEvent(r *http.Request, attrs auth.Attributes, err error) audit.Event {
+	event := audit.FromRequest(r, audit.AuthorizationDenied)
+	event.Namespace = attrs.Namespace
+	if attrs.Resource == "nodes" {
+		event.Node = attrs.Name
+	} else {
+		event.Pod = attrs.Name
+	}
+	event.Container = mux.Vars(r)["container"]
+	event.Action = attrs.Verb + " " + attrs.Resource + "/" + attrs.Subresource
+	event.Reason = err.Error()
+	return event
+}
+
+// requestUser return name of user authenticated by auth.Middleware.
+func requestUser(r *http.Request) string {
+	if user, ok := auth.UserFrom(r.Context()); ok {
+		return user.Name
+	}
+	return ""
+}
+
+// isAdmin check whether user of r is in admin group.
+func isAdmin(r *http.Request) bool {
+	user, ok := auth.UserFrom(r.Context())
+	if !ok || *adminGroup == "" {
+		return false
+	}
+	for _, g := range user.Groups {
+		if g == *adminGroup {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/maoqide/kubeutil/pkg/limit"
+)
+
+var (
+	maxSessions        = flag.Int("max-sessions", 0, "max concurrent terminal sessions, 0 for unlimited")
+	maxSessionsPerUser = flag.Int("max-sessions-per-user", 0, "max concurrent terminal sessions of a user, 0 for unlimited")
+	maxSessionsPerPod  = flag.Int("max-sessions-per-pod", 0, "max concurrent terminal sessions to a pod or node, 0 for unlimited")
+	maxLogs            = flag.Int("max-log-streams", 0, "max concurrent log streams, 0 for unlimited")
+	maxLogsPerUser     = flag.Int("max-log-streams-per-user", 0, "max concurrent log streams of a user, 0 for unlimited")
+	maxLogsPerPod      = flag.Int("max-log-streams-per-pod", 0, "max concurrent log streams of a pod, 0 for unlimited")
+
+	sessionLimiter *limit.Limiter
+	logLimiter     *limit.Limiter
+)
+
+// setupLimits create limiters from flags.
+func setupLimits() {
+	sessionLimiter = limit.New("terminal sessions", limit.Limits{Global: *maxSessions, PerUser: *maxSessionsPerUser, PerPod: *maxSessionsPerPod})
+	logLimiter = limit.New("log streams", limit.Limits{Global: *maxLogs, PerUser: *maxLogsPerUser, PerPod: *maxLogsPerPod})
+}
+
+// acquire acquire a slot of l for user of r on pod, reject the request with 429 if any limit is reached.
+// must be called before the websocket upgrade, release must be called once done if ok.
+func acquire(w http.ResponseWriter, r *http.Request, l *limit.Limiter, pod string) (release func(), ok bool) {
+	release, err := l.Acquire(requestUser(r), pod)
+	if err != nil {
+		var limitErr *limit.Error
+		if !errors.As(err, &limitErr) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return nil, false
+		}
+		log.Printf("%s %s rejected: %v\n", r.Method, r.URL.Path, err)
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return nil, false
+	}
+	return release, true
+}
+
+// serveAdminLimits show limits and current usage of terminal sessions and log streams.
+func serveAdminLimits(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]limit.Usage{
+		"sessions": sessionLimiter.Usage(),
+		"logs":     logLimiter.Usage(),
+	})
+}
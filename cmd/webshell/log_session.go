@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	kubeLog "github.com/maoqide/kubeutil/pkg/kube/log"
+	"github.com/maoqide/kubeutil/pkg/limit"
+	"github.com/maoqide/kubeutil/pkg/redact"
+)
+
+const (
+	// maxSnapshotBytes caps log snapshot requested by client.
+	maxSnapshotBytes = 10 << 20
+	// snapshotTimeout limits fetching log snapshot.
+	snapshotTimeout = 30 * time.Second
+)
+
+var errSnapshotFull = errors.New("snapshot is full")
+
+// logStreamFunc stream log of container with opts to out line by line, until ctx is done or the log ends.
+// lines of each container must be written through lines, before they are prefixed.
+type logStreamFunc func(ctx context.Context, out io.Writer, opts *kubeLog.Options, container string, lines kubeLog.SourceWriter) error
+
+// logSession serves a log websocket, the stream is changed or restarted by controls from client.
+type logSession struct {
+	writer    *kubeLog.WsLogger
+	redactors *podRedactors
+	// limiter to acquire a slot of user for each container streamed, nil if acquired by caller,
+	// e.g. of a workload whose pods are streamed at once.
+	limiter   *limit.Limiter
+	user      string
+	namespace string
+	opts      *kubeLog.Options
+	container string
+	// name of snapshot file, without extension
+	name   string
+	stream logStreamFunc
+
+	// guards filter, which is read by streams
+	mu     sync.Mutex
+	filter *kubeLog.FilterOptions
+
+	// cancel and done of the running stream, nil if not running
+	cancel context.CancelFunc
+	done   chan error
+}
+
+// run stream log until client is gone, or the stream ends for plain text clients which could not control it.
+func (s *logSession) run() {
+	defer s.stop()
+	s.start()
+	for {
+		select {
+		case err := <-s.done:
+			s.cancel()
+			s.cancel, s.done = nil, nil
+			if err != nil {
+				log.Printf("log %s err: %v\n", s.name, err)
+				s.writer.Error(fmt.Sprintf("log err: %v", err))
+			} else {
+				s.writer.Status("log stream ended")
+			}
+			if !s.writer.Typed() {
+				return
+			}
+		case c := <-s.writer.Controls():
+			s.control(c)
+		case <-s.writer.Done():
+			return
+		}
+	}
+}
+
+// start start streaming with current options.
+func (s *logSession) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	opts, container := *s.opts, s.container
+	go func() {
+		done <- s.stream(ctx, s.writer, &opts, container, s.sourceLines(ctx))
+	}()
+	s.cancel, s.done = cancel, done
+}
+
+// stop stop the running stream and wait for it to return.
+func (s *logSession) stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+	s.cancel, s.done = nil, nil
+}
+
+func (s *logSession) control(c kubeLog.Control) {
+	switch c.Operation {
+	case kubeLog.ControlFilter:
+		if c.Filter != nil {
+			if _, err := kubeLog.NewFilter(io.Discard, *c.Filter); err != nil {
+				s.writer.Error(err.Error())
+				return
+			}
+		}
+		s.mu.Lock()
+		s.filter = c.Filter
+		s.mu.Unlock()
+		s.writer.Status("filter changed")
+	case kubeLog.ControlRestream:
+		if c.Options == nil {
+			s.writer.Error("options are required to restream")
+			return
+		}
+		if err := c.Options.Validate(); err != nil {
+			s.writer.Error(err.Error())
+			return
+		}
+		s.opts = c.Options
+		s.restart()
+	case kubeLog.ControlContainer:
+		if c.Container == "" {
+			s.writer.Error("container is required")
+			return
+		}
+		s.container = c.Container
+		s.restart()
+	case kubeLog.ControlSnapshot:
+		s.snapshot()
+	}
+}
+
+// restart restart the stream, the filter starts over too.
+func (s *logSession) restart() {
+	s.stop()
+	s.writer.Status(fmt.Sprintf("restreaming container %s", s.containerName()))
+	s.start()
+}
+
+// snapshot send current log, redacted and filtered, without following it.
+func (s *logSession) snapshot() {
+	ctx, cancel := context.WithTimeout(context.Background(), snapshotTimeout)
+	defer cancel()
+	opts := *s.opts
+	opts.Follow = false
+	buf := &snapshotWriter{}
+	err := s.stream(ctx, buf, &opts, s.container, s.sourceLines(ctx))
+	if errors.Is(err, errSnapshotFull) {
+		s.writer.Status(fmt.Sprintf("snapshot truncated at %d bytes", maxSnapshotBytes))
+	} else if err != nil {
+		s.writer.Error(fmt.Sprintf("snapshot err: %v", err))
+		return
+	}
+	s.writer.Send(kubeLog.Frame{Type: kubeLog.FrameSnapshot, Data: string(buf.data), Name: s.name + ".log"})
+}
+
+func (s *logSession) containerName() string {
+	if s.container == "" {
+		return "all"
+	}
+	return s.container
+}
+
+// sourceLines return SourceWriter of streams, lines of each container are redacted with secrets of its pod,
+// and filtered on their own.
+func (s *logSession) sourceLines(ctx context.Context) kubeLog.SourceWriter {
+	return func(source kubeLog.Source, w io.Writer) (io.Writer, error) {
+		release := func() {}
+		if s.limiter != nil {
+			var err error
+			if release, err = s.limiter.Acquire(s.user, s.namespace+"/"+source.Pod); err != nil {
+				return nil, err
+			}
+		}
+		redactor, err := s.redactors.get(ctx, source.Pod)
+		if err != nil {
+			release()
+			// do not leak secrets when redaction is enabled.
+			return nil, fmt.Errorf("redact log of %s err: %v", source, err)
+		}
+		return &sourceFilter{s: s, w: w, redactor: redactor, release: release}, nil
+	}
+}
+
+func (s *logSession) currentFilter() *kubeLog.FilterOptions {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.filter
+}
+
+// sourceFilter writes lines of a container redacted and filtered by the current filter of session,
+// filtering starts over when the filter is changed.
+type sourceFilter struct {
+	s        *logSession
+	w        io.Writer
+	redactor *redact.Redactor
+	filter   *kubeLog.FilterOptions
+	out      io.Writer
+	// release slot of the stream acquired for the container
+	release func()
+}
+
+func (f *sourceFilter) Write(p []byte) (int, error) {
+	if filter := f.s.currentFilter(); f.out == nil || filter != f.filter {
+		f.filter, f.out = filter, logWriter(f.w, filter, f.redactor)
+	}
+	return f.out.Write(p)
+}
+
+// Close release slot of the stream, called once the stream of the container ends.
+func (f *sourceFilter) Close() error {
+	f.release()
+	return nil
+}
+
+// snapshotWriter collects lines up to maxSnapshotBytes.
+type snapshotWriter struct {
+	data []byte
+}
+
+func (w *snapshotWriter) Write(p []byte) (int, error) {
+	if len(w.data)+len(p)+1 > maxSnapshotBytes {
+		return 0, errSnapshotFull
+	}
+	w.data = append(append(w.data, p...), '\n')
+	return len(p), nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/maoqide/kubeutil/pkg/audit"
+	"github.com/maoqide/kubeutil/pkg/auth"
+	"github.com/maoqide/kubeutil/pkg/kube"
+	kubeLog "github.com/maoqide/kubeutil/pkg/kube/log"
+	"github.com/maoqide/kubeutil/pkg/redact"
+	"github.com/maoqide/kubeutil/utils"
+)
+
+var maxLogSources = flag.Int("max-log-sources", 50, "max containers in one aggregated log stream of a workload")
+
+// serveWsWorkloadLogs stream aggregated log of all pods of a deployment, statefulset, or label selector by query param selector.
+// all containers are streamed unless query param container is set. with follow and resilient,
+// new pods and restarted containers are followed as they start, e.g. across rollouts.
+func serveWsWorkloadLogs(w http.ResponseWriter, r *http.Request) {
+	pathParams := mux.Vars(r)
+	namespace := pathParams["namespace"]
+	kind, name := pathParams["kind"], pathParams["name"]
+	query := r.URL.Query()
+	if kind == "" {
+		kind, name = "selector", query.Get("selector")
+	}
+	containerName := query.Get("container")
+	order, _ := utils.StringToBool(query.Get("order"))
+	resilient, _ := utils.StringToBool(query.Get("resilient"))
+	logOpts, err := kubeLog.ParseOptions(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filterOpts, err := kubeLog.ParseFilterOptions(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opt := logOpts.PodLogOptions("")
+	log.Printf("log %s: %s, container: %s, namespace: %s, options: %+v\n", kind, name, containerName, namespace, opt)
+
+	if !authorize(w, r, auth.Attributes{Verb: "get", Resource: "pods", Subresource: "log", Namespace: namespace}) {
+		return
+	}
+	writer, err := kubeLog.NewWsLogger(w, r, nil)
+	if err != nil {
+		log.Printf("get writer failed: %v\n", err)
+		return
+	}
+	defer func() {
+		log.Println("close session.")
+		writer.Close()
+	}()
+	fail := func(msg string) {
+		log.Println(msg)
+		writer.Error(msg)
+	}
+
+	client, err := kube.GetRequestClient(r.Context(), *impersonate)
+	if err != nil {
+		fail(fmt.Sprintf("Get kubernetes client error! err: %v", err))
+		return
+	}
+	pods, err := workloadPods(context.TODO(), client, kind, name, namespace)
+	if err != nil {
+		fail(fmt.Sprintf("Get pods of %s %s error! err: %v", kind, name, err))
+		return
+	}
+	podPtrs := make([]*corev1.Pod, len(pods))
+	for i := range pods {
+		podPtrs[i] = &pods[i]
+	}
+	// pods attached later are redacted with their own secrets.
+	redactors, err := newPodRedactors(context.TODO(), client, namespace, podPtrs...)
+	if err != nil {
+		fail(fmt.Sprintf("Redact output error! err: %v", err))
+		return
+	}
+	event := audit.FromRequest(r, audit.LogsOpen)
+	event.Namespace, event.Workload, event.Container = namespace, kind+"/"+name, containerName
+	auditor.Log(event)
+
+	session := &logSession{
+		writer:    writer,
+		redactors: redactors,
+		// every container streamed takes a slot, like a log stream of the pod.
+		limiter:   logLimiter,
+		user:      requestUser(r),
+		namespace: namespace,
+		filter:    filterOpts,
+		opts:      logOpts,
+		container: containerName,
+		name:      kind + "-" + name,
+		stream: func(ctx context.Context, out io.Writer, opts *kubeLog.Options, container string, lines kubeLog.SourceWriter) error {
+			opt := opts.PodLogOptions("")
+			// log of previous container does not go on, it is not followed across restarts.
+			if opt.Follow && resilient && !opt.Previous {
+				selector, err := workloadSelector(ctx, client, kind, name, namespace)
+				if err != nil {
+					return err
+				}
+				follower := &kubeLog.Follower{
+					Streamer:  client.PodBox,
+					Pods:      client.PodBox,
+					Namespace: namespace,
+					Selector:  selector,
+					Container: container,
+					Options:   *opt,
+					Prefix:    true,
+					Color:     true,
+					Lines:     lines,
+				}
+				return follower.Follow(ctx, out)
+			}
+			pods, err := workloadPods(ctx, client, kind, name, namespace)
+			if err != nil {
+				return err
+			}
+			sources := kubeLog.PodSources(pods, container)
+			if len(sources) == 0 {
+				return fmt.Errorf("no container found in pods of %s %s", kind, name)
+			}
+			if len(sources) > *maxLogSources {
+				return fmt.Errorf("too many containers in pods of %s %s: %d, limit %d, choose one container", kind, name, len(sources), *maxLogSources)
+			}
+			aggregator := &kubeLog.Aggregator{
+				Streamer:  client.PodBox,
+				Namespace: namespace,
+				Sources:   sources,
+				Options:   *opt,
+				Color:     true,
+				Order:     order,
+				Lines:     lines,
+			}
+			return aggregator.Stream(ctx, out)
+		},
+	}
+	session.run()
+}
+
+// logWriter return writer of log lines of a container to w, lines are masked by redactor first,
+// then filtered by filterOpts. either could be nil.
+func logWriter(w io.Writer, filterOpts *kubeLog.FilterOptions, redactor *redact.Redactor) io.Writer {
+	out := w
+	if filterOpts != nil {
+		// options are validated by ParseFilterOptions.
+		if filter, err := kubeLog.NewFilter(out, *filterOpts); err == nil {
+			out = filter
+		}
+	}
+	if redactor != nil {
+		// redact before filter, so that highlighting does not split secrets.
+		out = redact.NewLineWriter(out, redactor)
+	}
+	return out
+}
+
+// workloadPods get pods of deployment or statefulset name, or pods matching label selector name.
+func workloadPods(ctx context.Context, client *kube.Client, kind, name, namespace string) ([]corev1.Pod, error) {
+	var (
+		pods *corev1.PodList
+		err  error
+	)
+	switch kind {
+	case "deployment":
+		pods, err = client.DeploymentBox.GetPods(ctx, name, namespace)
+	case "statefulset":
+		pods, err = client.StatefulSetBox.GetPods(ctx, name, namespace)
+	case "selector":
+		if name == "" {
+			return nil, fmt.Errorf("label selector is required")
+		}
+		pods, err = client.PodBox.List(ctx, namespace, name)
+	default:
+		return nil, fmt.Errorf("unknown workload kind '%s'", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pods.Items, nil
+}
+
+// workloadSelector get label selector of pods of deployment or statefulset name, or label selector name itself.
+func workloadSelector(ctx context.Context, client *kube.Client, kind, name, namespace string) (string, error) {
+	var selector *metav1.LabelSelector
+	switch kind {
+	case "deployment":
+		deployment, err := client.DeploymentBox.Get(ctx, name, namespace)
+		if err != nil {
+			return "", err
+		}
+		selector = deployment.Spec.Selector
+	case "statefulset":
+		sts, err := client.StatefulSetBox.Get(ctx, name, namespace)
+		if err != nil {
+			return "", err
+		}
+		selector = sts.Spec.Selector
+	case "selector":
+		if name == "" {
+			return "", fmt.Errorf("label selector is required")
+		}
+		return name, nil
+	default:
+		return "", fmt.Errorf("unknown workload kind '%s'", kind)
+	}
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return "", err
+	}
+	return s.String(), nil
+}
+
+// hasContainer check whether pod has container.
+func hasContainer(pod *corev1.Pod, container string) bool {
+	for _, c := range pod.Spec.Containers {
+		if c.Name == container {
+			return true
+		}
+	}
+	return false
+}
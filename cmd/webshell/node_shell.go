@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/maoqide/kubeutil/pkg/audit"
+	"github.com/maoqide/kubeutil/pkg/auth"
+	"github.com/maoqide/kubeutil/pkg/kube"
+	terminal "github.com/maoqide/kubeutil/pkg/terminal"
+	wsterminal "github.com/maoqide/kubeutil/pkg/terminal/websocket"
+)
+
+// node shell sessions are recorded with this container name, node name as pod.
+const nodeShellRecordContainer = "node-shell"
+
+func serveWsNodeShell(w http.ResponseWriter, r *http.Request) {
+	node := mux.Vars(r)["node"]
+	log.Printf("node shell: %s\n", node)
+	if !*nodeShell {
+		http.Error(w, "Node shell is disabled", http.StatusNotFound)
+		return
+	}
+	// node shell is root on the host, require the same permission as kubelet api.
+	if !authorize(w, r, auth.Attributes{Verb: "create", Resource: "nodes", Subresource: "proxy", Name: node}) {
+		return
+	}
+	// namespaces could not contain ':', so node keys do not collide with namespace/pod keys.
+	release, ok := acquire(w, r, sessionLimiter, "node:"+node)
+	if !ok {
+		return
+	}
+	defer release()
+
+	pty, err := wsterminal.NewTerminalSession(w, r, nil)
+	if err != nil {
+		log.Printf("get pty failed: %v\n", err)
+		return
+	}
+	defer func() {
+		log.Println("close session.")
+		pty.Close()
+	}()
+	pty.AllowHandoff(*allowHandoff)
+	pty.SetTimeouts(*idleTimeout, *maxSessionDuration)
+	pty.SetResumable(*resumeGrace)
+	terminal.DefaultRegistry.Update(pty.ID(), func(info *terminal.SessionInfo) {
+		info.User = requestUser(r)
+		info.Namespace = *nodeShellNamespace
+		info.Node = node
+	})
+
+	// node shell pod is privileged, it is created by kubeutil itself after nodes/proxy is authorized.
+	client, err := kube.GetClient()
+	if err != nil {
+		terminalError(pty, fmt.Sprintf("Get kubernetes client error! err: %v", err))
+		return
+	}
+	redactor, err := podRedactor(pty.Context())
+	if err != nil {
+		terminalError(pty, fmt.Sprintf("Redact output error! err: %v", err))
+		return
+	}
+	if redactor != nil {
+		pty.SetRedactor(redactor)
+	}
+	if err := recordSession(pty, requestUser(r), *nodeShellNamespace, node, nodeShellRecordContainer); err != nil {
+		terminalError(pty, fmt.Sprintf("Record session error! err: %v", err))
+		return
+	}
+	event := audit.FromRequest(r, audit.SessionStart)
+	event.SessionID, event.Namespace, event.Node, event.Action = pty.ID(), *nodeShellNamespace, node, "node-shell"
+	auditor.Log(event)
+	// policy rules match node shells by the namespace of node shell pods.
+	filterCommands(pty, event)
+	pty.Start()
+	start := time.Now()
+	pty.Stderr().Write([]byte(fmt.Sprintf("starting shell on node %s...\r\n", node)))
+	opts := kube.NodeShellOptions{
+		Image:     *nodeShellImage,
+		Namespace: *nodeShellNamespace,
+		Command:   terminal.ShellCommand([]string{"sh"}, shellEnv()),
+	}
+	err = client.PodBox.NodeShell(pty.Context(), opts, pty, node)
+	code, reason := terminal.ExitStatus(err)
+	log.Printf("node shell: %s, exit code: %d, reason: %s\n", node, code, reason)
+	pty.Exit(code, reason)
+	auditSessionEnd(event, pty, code, reason, start)
+}
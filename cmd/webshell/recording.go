@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/maoqide/kubeutil/pkg/auth"
+	"github.com/maoqide/kubeutil/pkg/terminal/recorder"
+	wsterminal "github.com/maoqide/kubeutil/pkg/terminal/websocket"
+)
+
+// recordStore is nil if recording is disabled.
+var recordStore recorder.Store
+
+// serveRecordings list recordings, filtered by query params namespace, pod, user, since and until.
+// since and until are in RFC3339 format. only recordings of sessions the user could open are listed.
+func serveRecordings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if recordStore == nil {
+		http.Error(w, "Recording is disabled", http.StatusNotFound)
+		return
+	}
+	// listing authorizes each session, it may take longer than the server write timeout.
+	clearWriteDeadline(w)
+	query := r.URL.Query()
+	filter := recorder.Filter{
+		Namespace: query.Get("namespace"),
+		Pod:       query.Get("pod"),
+		User:      query.Get("user"),
+	}
+	var err error
+	if filter.Since, err = parseTime(query.Get("since")); err != nil {
+		http.Error(w, fmt.Sprintf("invalid since: %v", err), http.StatusBadRequest)
+		return
+	}
+	if filter.Until, err = parseTime(query.Get("until")); err != nil {
+		http.Error(w, fmt.Sprintf("invalid until: %v", err), http.StatusBadRequest)
+		return
+	}
+	metas, err := recordStore.List(filter)
+	if err != nil {
+		log.Printf("list recordings err: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	visible := []recorder.Meta{}
+	allowed := map[auth.Attributes]bool{}
+	for _, meta := range metas {
+		attrs := recordingAttributes(&meta)
+		ok, checked := allowed[attrs]
+		if !checked {
+			ok = auth.Authorize(r.Context(), authorizer, attrs) == nil
+			allowed[attrs] = ok
+		}
+		if ok {
+			visible = append(visible, meta)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(visible)
+}
+
+// serveRecording download raw asciicast file of recording.
+func serveRecording(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// long recordings take longer to send than the server write timeout.
+	clearWriteDeadline(w)
+	rc, ok := openRecording(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	defer rc.Close()
+	w.Header().Set("Content-Type", "application/x-asciicast")
+	if _, err := io.Copy(w, rc); err != nil {
+		log.Printf("download recording %s err: %v\n", mux.Vars(r)["id"], err)
+	}
+}
+
+// clearWriteDeadline remove write deadline of response w set by server WriteTimeout.
+func clearWriteDeadline(w http.ResponseWriter) {
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("clear write deadline err: %v\n", err)
+	}
+}
+
+// serveWsReplay play recording to websocket.
+func serveWsReplay(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	log.Printf("replay recording: %s\n", id)
+	rc, ok := openRecording(w, r, id)
+	if !ok {
+		return
+	}
+	player, err := recorder.NewPlayer(rc)
+	rc.Close()
+	if err != nil {
+		log.Printf("load recording %s err: %v\n", id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := wsterminal.Replay(w, r, player); err != nil {
+		log.Printf("replay recording %s err: %v\n", id, err)
+	}
+}
+
+// openRecording open recording with id, if user of r could open the recorded session.
+func openRecording(w http.ResponseWriter, r *http.Request, id string) (io.ReadCloser, bool) {
+	if recordStore == nil {
+		http.Error(w, "Recording is disabled", http.StatusNotFound)
+		return nil, false
+	}
+	meta, err := recordStore.Stat(id)
+	if errors.Is(err, recorder.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("stat recording %s err: %v\n", id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if !authorize(w, r, recordingAttributes(meta)) {
+		return nil, false
+	}
+	rc, err := recordStore.Open(id)
+	if errors.Is(err, recorder.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("open recording %s err: %v\n", id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return rc, true
+}
+
+// recordingAttributes return permission required to see recording of meta, the same as to open the session,
+// recordings include input of the session.
+func recordingAttributes(meta *recorder.Meta) auth.Attributes {
+	if meta.Namespace == *nodeShellNamespace && meta.Container == nodeShellRecordContainer {
+		return auth.Attributes{Verb: "create", Resource: "nodes", Subresource: "proxy", Name: meta.Pod}
+	}
+	return auth.Attributes{Verb: "create", Resource: "pods", Subresource: "exec", Namespace: meta.Namespace, Name: meta.Pod}
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/maoqide/kubeutil/pkg/kube"
+	"github.com/maoqide/kubeutil/pkg/redact"
+)
+
+var (
+	redactSecrets  = flag.Bool("redact", false, "mask values of secrets used by the pod and well known credentials in terminal and log output")
+	redactPatterns = append([]string(nil), redact.DefaultPatterns...)
+)
+
+func init() {
+	flag.Func("redact-pattern", "additional regexp of values to mask with -redact, could be repeated, only the first capture group is masked if any", func(s string) error {
+		redactPatterns = append(redactPatterns, s)
+		return nil
+	})
+}
+
+// podRedactor return Redactor masking secrets of pods, nil if redaction is disabled.
+// pods could be empty for sessions not in a pod, e.g. node shell, only patterns are masked then.
+func podRedactor(ctx context.Context, pods ...*corev1.Pod) (*redact.Redactor, error) {
+	if !*redactSecrets {
+		return nil, nil
+	}
+	var values []string
+	if len(pods) > 0 {
+		// user may not be allowed to read secrets, resolve them as kubeutil itself.
+		client, err := kube.GetClient()
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range pods {
+			v, err := client.SecretBox.PodSecretValues(ctx, pod)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v...)
+		}
+	}
+	return redact.New(values, redactPatterns)
+}
+
+// podRedactors resolve and cache redactors of pods in a namespace by name, for log streams
+// which attach to pods as they come, e.g. in a rollout.
+type podRedactors struct {
+	client    *kube.Client
+	namespace string
+
+	mu        sync.Mutex
+	redactors map[string]*redact.Redactor
+}
+
+// newPodRedactors create podRedactors with redactors of pods resolved, nil if redaction is disabled.
+func newPodRedactors(ctx context.Context, client *kube.Client, namespace string, pods ...*corev1.Pod) (*podRedactors, error) {
+	if !*redactSecrets {
+		return nil, nil
+	}
+	p := &podRedactors{client: client, namespace: namespace, redactors: map[string]*redact.Redactor{}}
+	for _, pod := range pods {
+		r, err := podRedactor(ctx, pod)
+		if err != nil {
+			return nil, err
+		}
+		p.redactors[pod.Name] = r
+	}
+	return p, nil
+}
+
+// get get redactor of pod, nil if p is nil.
+func (p *podRedactors) get(ctx context.Context, pod string) (*redact.Redactor, error) {
+	if p == nil {
+		return nil, nil
+	}
+	p.mu.Lock()
+	r, ok := p.redactors[pod]
+	p.mu.Unlock()
+	if ok {
+		return r, nil
+	}
+	obj, err := p.client.PodBox.Get(ctx, pod, p.namespace)
+	if err != nil {
+		return nil, err
+	}
+	if r, err = podRedactor(ctx, obj); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.redactors[pod] = r
+	p.mu.Unlock()
+	return r, nil
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/maoqide/kubeutil/pkg/audit"
+	"github.com/maoqide/kubeutil/pkg/auth"
+	"github.com/maoqide/kubeutil/pkg/kube"
+	terminal "github.com/maoqide/kubeutil/pkg/terminal"
+	"github.com/maoqide/kubeutil/pkg/terminal/policy"
+	"github.com/maoqide/kubeutil/pkg/terminal/recorder"
+	wsterminal "github.com/maoqide/kubeutil/pkg/terminal/websocket"
+	"github.com/maoqide/kubeutil/utils"
+)
+
+// terminalRunner connects pty to the validated container, blocks until the session ends.
+type terminalRunner func(client *kube.Client, pty *wsterminal.TerminalSession, r *http.Request, pod *corev1.Pod, containerName string) error
+
+// terminalHandler serve websocket terminal for container in path, run by runner.
+func terminalHandler(action string, runner terminalRunner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pathParams := mux.Vars(r)
+		namespace := pathParams["namespace"]
+		podName := pathParams["pod"]
+		containerName := pathParams["container"]
+		log.Printf("%s pod: %s, container: %s, namespace: %s\n", action, podName, containerName, namespace)
+		attrs := []auth.Attributes{{Verb: "create", Resource: "pods", Subresource: action, Namespace: namespace, Name: podName}}
+		if r.URL.Query().Get("mode") == "debug" {
+			// debug session attaches to the ephemeral container it adds, instead of exec.
+			attrs = []auth.Attributes{
+				{Verb: "create", Resource: "pods", Subresource: "attach", Namespace: namespace, Name: podName},
+				{Verb: "patch", Resource: "pods", Subresource: "ephemeralcontainers", Namespace: namespace, Name: podName},
+			}
+		}
+		if !authorize(w, r, attrs...) {
+			return
+		}
+		release, ok := acquire(w, r, sessionLimiter, namespace+"/"+podName)
+		if !ok {
+			return
+		}
+		defer release()
+
+		pty, err := wsterminal.NewTerminalSession(w, r, nil)
+		if err != nil {
+			log.Printf("get pty failed: %v\n", err)
+			return
+		}
+		defer func() {
+			log.Println("close session.")
+			pty.Close()
+		}()
+		pty.AllowHandoff(*allowHandoff)
+		pty.SetTimeouts(*idleTimeout, *maxSessionDuration)
+		pty.SetResumable(*resumeGrace)
+
+		client, err := kube.GetRequestClient(r.Context(), *impersonate)
+		if err != nil {
+			terminalError(pty, fmt.Sprintf("Get kubernetes client error! err: %v", err))
+			return
+		}
+		pod, err := client.PodBox.Get(context.TODO(), podName, namespace)
+		if err != nil {
+			terminalError(pty, fmt.Sprintf("Get pod error! err: %v", err))
+			return
+		}
+		ok, err = terminal.ValidatePod(pod, containerName)
+		if !ok {
+			terminalError(pty, fmt.Sprintf("Validate pod error! err: %v", err))
+			return
+		}
+		redactor, err := podRedactor(pty.Context(), pod)
+		if err != nil {
+			// do not leak secrets when redaction is enabled.
+			terminalError(pty, fmt.Sprintf("Redact output error! err: %v", err))
+			return
+		}
+		if redactor != nil {
+			pty.SetRedactor(redactor)
+		}
+		terminal.DefaultRegistry.Update(pty.ID(), func(info *terminal.SessionInfo) {
+			info.User = requestUser(r)
+			info.Namespace = namespace
+			info.Pod = podName
+			info.Container = containerName
+		})
+		if err := recordSession(pty, requestUser(r), namespace, podName, containerName); err != nil {
+			// do not allow unaudited sessions when recording is enabled.
+			terminalError(pty, fmt.Sprintf("Record session error! err: %v", err))
+			return
+		}
+		event := audit.FromRequest(r, audit.SessionStart)
+		event.SessionID, event.Namespace, event.Pod, event.Container = pty.ID(), namespace, podName, containerName
+		event.Action = action
+		if mode := r.URL.Query().Get("mode"); mode != "" {
+			event.Action = mode
+		}
+		auditor.Log(event)
+		filterCommands(pty, event)
+		if action == "attach" {
+			// attach tty only if container allocated one, like kubectl attach.
+			pty.SetTty(containerTTY(pod, containerName))
+		}
+		pty.Start()
+		start := time.Now()
+		err = runner(client, pty, r, pod, containerName)
+		code, reason := terminal.ExitStatus(err)
+		log.Printf("%s pod: %s, container: %s, namespace: %s, exit code: %d, reason: %s\n",
+			action, podName, containerName, namespace, code, reason)
+		pty.Exit(code, reason)
+		auditSessionEnd(event, pty, code, reason, start)
+	}
+}
+
+// runExec exec shell into container, or into an ephemeral debug container with mode=debug.
+func runExec(client *kube.Client, pty *wsterminal.TerminalSession, r *http.Request, pod *corev1.Pod, containerName string) error {
+	switch mode := r.URL.Query().Get("mode"); mode {
+	case "", "exec":
+		return execShell(client, pty, r.URL.Query().Get("shell"), pod.Namespace, pod.Name, containerName)
+	case "debug":
+		// debug container shares process namespace with the chosen container unless target=false.
+		opts := kube.DebugOptions{Image: *debugImage, TargetContainer: containerName}
+		if target, err := utils.StringToBool(r.URL.Query().Get("target")); err == nil && !target {
+			opts.TargetContainer = ""
+		}
+		return client.PodBox.Debug(pty.Context(), opts, pty, pod.Namespace, pod.Name)
+	default:
+		return fmt.Errorf("unknown terminal mode '%s'", mode)
+	}
+}
+
+// runAttach attach to the main process of container.
+func runAttach(client *kube.Client, pty *wsterminal.TerminalSession, r *http.Request, pod *corev1.Pod, containerName string) error {
+	for _, c := range pod.Spec.Containers {
+		if c.Name != containerName {
+			continue
+		}
+		if !c.Stdin {
+			msg := fmt.Sprintf("container %s does not accept stdin, input is ignored\r\n", containerName)
+			pty.Stderr().Write([]byte(msg))
+		}
+	}
+	return client.PodBox.AttachWithContext(pty.Context(), pty, pod.Namespace, pod.Name, containerName)
+}
+
+// containerTTY return whether container of pod allocates a tty.
+func containerTTY(pod *corev1.Pod, containerName string) bool {
+	for _, c := range pod.Spec.Containers {
+		if c.Name == containerName {
+			return c.TTY
+		}
+	}
+	return false
+}
+
+// execShell exec the first available shell into container.
+func execShell(client *kube.Client, pty *wsterminal.TerminalSession, preferred, namespace, podName, containerName string) error {
+	candidates, err := terminal.PreferShell(terminal.ParseShells(*shells), preferred)
+	if err != nil {
+		return err
+	}
+	shell, err := client.PodBox.DetectShell(pty.Context(), candidates, namespace, podName, containerName)
+	if err != nil {
+		return err
+	}
+	return client.PodBox.ExecWithContext(pty.Context(), terminal.ShellCommand(shell, shellEnv()), pty, namespace, podName, containerName)
+}
+
+// shellEnv return env exported in shell
+func shellEnv() []string {
+	env := []string{"TERM=" + *termEnv}
+	if *langEnv != "" {
+		env = append(env, "LANG="+*langEnv)
+	}
+	return env
+}
+
+// filterCommands check command lines of pty against command policy, violations are audited.
+func filterCommands(pty *wsterminal.TerminalSession, start audit.Event) {
+	if commandPolicy == nil || !commandPolicy.Applies(start.Namespace) {
+		return
+	}
+	filter := policy.NewFilter(commandPolicy, start.Namespace)
+	filter.OnViolation = func(line string, d policy.Decision) {
+		event := start
+		event.Time = time.Time{}
+		event.Type = audit.CommandDenied
+		event.Command = line
+		event.Reason = fmt.Sprintf("%s: %s", d.Action, d.Rule)
+		auditor.Log(event)
+	}
+	pty.SetInputFilter(filter)
+}
+
+// auditSessionEnd log end of session started with event start.
+func auditSessionEnd(start audit.Event, pty *wsterminal.TerminalSession, code int, reason string, startTime time.Time) {
+	end := start
+	end.Time = time.Time{}
+	end.Type = audit.SessionEnd
+	end.ExitCode = &code
+	end.Reason = reason
+	if r := pty.EndReason(); r != "" {
+		end.Reason = r
+	}
+	end.Duration = time.Since(startTime).Seconds()
+	auditor.Log(end)
+}
+
+// recordSession start recording pty if recording is enabled.
+func recordSession(pty *wsterminal.TerminalSession, user, namespace, podName, containerName string) error {
+	if recordStore == nil {
+		return nil
+	}
+	rec, err := recorder.New(recordStore, recorder.Meta{
+		SessionID: pty.ID(),
+		Namespace: namespace,
+		Pod:       podName,
+		Container: containerName,
+		User:      user,
+	})
+	if err != nil {
+		return err
+	}
+	pty.SetRecorder(rec)
+	return nil
+}
+
+// terminalError report error to terminal client and end the session.
+func terminalError(pty *wsterminal.TerminalSession, msg string) {
+	log.Println(msg)
+	pty.Stderr().Write([]byte(msg))
+	pty.Exit(terminal.ExitCodeError, msg)
+}
+
+func serveWsWatch(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	log.Printf("watch session: %s\n", id)
+	pty, ok := wsterminal.Lookup(id)
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	// watchers see everything of the session, require the permission to open it.
+	info, _ := terminal.DefaultRegistry.Info(id)
+	attrs := auth.Attributes{Verb: "create", Resource: "pods", Subresource: "exec", Namespace: info.Namespace, Name: info.Pod}
+	if info.Node != "" {
+		attrs = auth.Attributes{Verb: "create", Resource: "nodes", Subresource: "proxy", Name: info.Node}
+	}
+	if !authorize(w, r, attrs) {
+		return
+	}
+	if err := pty.Watch(w, r); err != nil {
+		log.Printf("watch session %s err: %v\n", id, err)
+	}
+}
+
+// serveWsResume reconnect client to its session after websocket dropped, with token and output offset in query.
+func serveWsResume(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	log.Printf("resume session: %s\n", id)
+	pty, ok := wsterminal.Lookup(id)
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	// only the user started the session could resume it.
+	if info, _ := terminal.DefaultRegistry.Info(id); info.User != requestUser(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	offset, err := utils.StringToInt64(r.URL.Query().Get("offset"))
+	if err != nil {
+		http.Error(w, "Invalid offset", http.StatusBadRequest)
+		return
+	}
+	if err := pty.Resume(w, r, r.URL.Query().Get("token"), offset); err != nil {
+		log.Printf("resume session %s err: %v\n", id, err)
+	}
+}
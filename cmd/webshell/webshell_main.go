@@ -8,29 +8,59 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	_ "net/http/pprof"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
-	corev1 "k8s.io/api/core/v1"
 
 	_ "github.com/maoqide/kubeutil/initialize"
+	"github.com/maoqide/kubeutil/pkg/audit"
+	"github.com/maoqide/kubeutil/pkg/auth"
+	"github.com/maoqide/kubeutil/pkg/client"
 	"github.com/maoqide/kubeutil/pkg/kube"
 	kubeLog "github.com/maoqide/kubeutil/pkg/kube/log"
+	"github.com/maoqide/kubeutil/pkg/redact"
 	terminal "github.com/maoqide/kubeutil/pkg/terminal"
-	wsterminal "github.com/maoqide/kubeutil/pkg/terminal/websocket"
+	"github.com/maoqide/kubeutil/pkg/terminal/policy"
+	"github.com/maoqide/kubeutil/pkg/terminal/recorder"
 	"github.com/maoqide/kubeutil/utils"
 )
 
 var (
-	addr = flag.String("addr", ":8090", "http service address")
-	cmd  = []string{"/bin/sh"}
+	addr               = flag.String("addr", ":8090", "http service address")
+	recordDir          = flag.String("record-dir", "", "directory to store terminal session recordings in asciicast v2 format, recording is disabled if empty")
+	allowHandoff       = flag.Bool("allow-handoff", false, "allow terminal owner to hand stdin control over to a watcher")
+	shells             = flag.String("shells", terminal.DefaultShells, "comma separated shells probed in order, client could prefer one of them by query param shell")
+	termEnv            = flag.String("term", "xterm-256color", "TERM of the shell")
+	langEnv            = flag.String("lang", "C.UTF-8", "LANG of the shell, not set if empty")
+	debugImage         = flag.String("debug-image", kube.DefaultDebugImage, "image of ephemeral debug container for terminal mode debug")
+	idleTimeout        = flag.Duration("idle-timeout", 0, "close terminal session without input for this long, 0 to disable")
+	nodeShell          = flag.Bool("node-shell", false, "enable node shell for users allowed to create nodes/proxy")
+	nodeShellNamespace = flag.String("node-shell-namespace", "default", "namespace to create node shell pods in")
+	nodeShellImage     = flag.String("node-shell-image", kube.DefaultDebugImage, "image of node shell pods, must contain nsenter")
+	adminGroup         = flag.String("admin-group", "system:masters", "group of users allowed to use admin api, admin api is disabled if empty")
+	impersonate        = flag.Bool("impersonate", false, "make kubernetes api requests as the authenticated user, requires impersonate permission")
+	resumeGrace        = flag.Duration("resume-grace", 2*time.Minute, "keep terminal session for client to resume after websocket dropped, 0 to disable")
+	maxSessionDuration = flag.Duration("max-session-duration", 0, "close terminal session lasting longer than this, 0 to disable")
+	policyFile         = flag.String("command-policy", "", "yaml file of command policy rules checked against command lines of terminal sessions")
+	policyConfigMap    = flag.String("command-policy-configmap", "", "load command policy from key policy.yaml of configmap namespace/name instead of file")
+
+	authOptions   auth.Options
+	auditOptions  audit.Options
+	auditor       *audit.Logger
+	commandPolicy *policy.Policy
 )
 
+func init() {
+	authOptions.AddFlags(flag.CommandLine)
+	auditOptions.AddFlags(flag.CommandLine)
+}
+
 func serveTerminal(w http.ResponseWriter, r *http.Request) {
-	// auth
 	if r.Method != "GET" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -39,7 +69,6 @@ func serveTerminal(w http.ResponseWriter, r *http.Request) {
 }
 
 func serveLogs(w http.ResponseWriter, r *http.Request) {
-	// auth
 	if r.Method != "GET" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -47,56 +76,32 @@ func serveLogs(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, "./frontend/logs.html")
 }
 
-func serveWsTerminal(w http.ResponseWriter, r *http.Request) {
+func serveWsLogs(w http.ResponseWriter, r *http.Request) {
 	pathParams := mux.Vars(r)
 	namespace := pathParams["namespace"]
 	podName := pathParams["pod"]
 	containerName := pathParams["container"]
-	log.Printf("exec pod: %s, container: %s, namespace: %s\n", podName, containerName, namespace)
-
-	pty, err := wsterminal.NewTerminalSession(w, r, nil)
+	resilient, _ := utils.StringToBool(r.URL.Query().Get("resilient"))
+	logOpts, err := kubeLog.ParseOptions(r.URL.Query())
 	if err != nil {
-		log.Printf("get pty failed: %v\n", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer func() {
-		log.Println("close session.")
-		pty.Close()
-	}()
-
-	client, err := kube.GetClient()
+	filterOpts, err := kubeLog.ParseFilterOptions(r.URL.Query())
 	if err != nil {
-		log.Printf("get kubernetes client failed: %v\n", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	pod, err := client.PodBox.Get(context.TODO(), podName, namespace)
-	if err != nil {
-		log.Printf("get kubernetes client failed: %v\n", err)
+	log.Printf("log pod: %s, container: %s, namespace: %s, options: %+v\n", podName, containerName, namespace, logOpts.PodLogOptions(containerName))
+
+	if !authorize(w, r, auth.Attributes{Verb: "get", Resource: "pods", Subresource: "log", Namespace: namespace, Name: podName}) {
 		return
 	}
-	ok, err := terminal.ValidatePod(pod, containerName)
+	release, ok := acquire(w, r, logLimiter, namespace+"/"+podName)
 	if !ok {
-		msg := fmt.Sprintf("Validate pod error! err: %v", err)
-		log.Println(msg)
-		pty.Write([]byte(msg))
 		return
 	}
-	err = client.PodBox.Exec(cmd, pty, namespace, podName, containerName)
-	if err != nil {
-		msg := fmt.Sprintf("Exec to pod error! err: %v", err)
-		log.Println(msg)
-		pty.Write([]byte(msg))
-	}
-}
-
-func serveWsLogs(w http.ResponseWriter, r *http.Request) {
-	pathParams := mux.Vars(r)
-	namespace := pathParams["namespace"]
-	podName := pathParams["pod"]
-	containerName := pathParams["container"]
-	tailLine, _ := utils.StringToInt64(r.URL.Query().Get("tail"))
-	follow, _ := utils.StringToBool(r.URL.Query().Get("follow"))
-	log.Printf("log pod: %s, container: %s, namespace: %s, tailLine: %d, follow: %v\n", podName, containerName, namespace, tailLine, follow)
+	defer release()
 
 	writer, err := kubeLog.NewWsLogger(w, r, nil)
 	if err != nil {
@@ -108,7 +113,7 @@ func serveWsLogs(w http.ResponseWriter, r *http.Request) {
 		writer.Close()
 	}()
 
-	client, err := kube.GetClient()
+	client, err := kube.GetRequestClient(r.Context(), *impersonate)
 	if err != nil {
 		log.Printf("get kubernetes client failed: %v\n", err)
 		return
@@ -118,41 +123,137 @@ func serveWsLogs(w http.ResponseWriter, r *http.Request) {
 		log.Printf("get kubernetes client failed: %v\n", err)
 		return
 	}
-	ok, err := terminal.ValidatePod(pod, containerName)
+	ok, err = terminal.ValidatePod(pod, containerName)
 	if !ok {
 		msg := fmt.Sprintf("Validate pod error! err: %v", err)
 		log.Println(msg)
-		writer.Write([]byte(msg))
-		writer.Close()
+		writer.Error(msg)
 		return
 	}
+	event := audit.FromRequest(r, audit.LogsOpen)
+	event.Namespace, event.Pod, event.Container = namespace, podName, containerName
+	auditor.Log(event)
 
-	opt := corev1.PodLogOptions{
-		Container: containerName,
-		Follow:    follow,
-		TailLines: &tailLine,
-	}
-
-	err = client.PodBox.LogStreamLine(context.TODO(), podName, namespace, &opt, writer)
+	redactors, err := newPodRedactors(r.Context(), client, namespace, pod)
 	if err != nil {
-		msg := fmt.Sprintf("log err: %v", err)
+		msg := fmt.Sprintf("Redact output error! err: %v", err)
 		log.Println(msg)
-		writer.Write([]byte(msg))
-		writer.Close()
+		writer.Error(msg)
+		return
+	}
+
+	session := &logSession{
+		writer:    writer,
+		redactors: redactors,
+		filter:    filterOpts,
+		opts:      logOpts,
+		container: containerName,
+		name:      podName,
+		stream: func(ctx context.Context, out io.Writer, opts *kubeLog.Options, container string, lines kubeLog.SourceWriter) error {
+			if !hasContainer(pod, container) {
+				return fmt.Errorf("pod has no container '%s'", container)
+			}
+			opt := opts.PodLogOptions(container)
+			if !opt.Follow || !resilient || opt.Previous {
+				w, err := lines(kubeLog.Source{Pod: podName, Container: container}, out)
+				if err != nil {
+					return err
+				}
+				if c, ok := w.(io.Closer); ok {
+					defer c.Close()
+				}
+				return client.PodBox.LogStreamLine(ctx, podName, namespace, opt, w)
+			}
+			// follow restarted container, or the pod replacing it, e.g. in a rollout.
+			follower := &kubeLog.Follower{
+				Streamer:  client.PodBox,
+				Pods:      client.PodBox,
+				Namespace: namespace,
+				Selector:  kubeLog.ReplacementSelector(pod),
+				Pod:       podName,
+				Container: container,
+				Options:   *opt,
+				Lines:     lines,
+			}
+			return follower.Follow(ctx, out)
+		},
 	}
+	session.run()
+}
+
+// loadCommandPolicy load command policy from file or configmap, nil if neither is set.
+func loadCommandPolicy() (*policy.Policy, error) {
+	switch {
+	case *policyFile != "" && *policyConfigMap != "":
+		return nil, fmt.Errorf("only one of -command-policy and -command-policy-configmap could be set")
+	case *policyFile != "":
+		return policy.LoadFile(*policyFile)
+	case *policyConfigMap != "":
+		namespace, name, ok := strings.Cut(*policyConfigMap, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid configmap '%s', expect namespace/name", *policyConfigMap)
+		}
+		return policy.LoadConfigMap(context.TODO(), *client.Clientset(), namespace, name, "policy.yaml")
+	}
+	return nil, nil
 }
 
 func main() {
+	flag.Parse()
+	setupLimits()
+	if *recordDir != "" {
+		recordStore = recorder.NewDirSink(*recordDir)
+	}
+	authenticator, err := authOptions.Authenticator(*client.Clientset())
+	if err != nil {
+		log.Fatalf("setup authentication err: %v", err)
+	}
+	authorizer, err = authOptions.Authorizer(*client.Clientset())
+	if err != nil {
+		log.Fatalf("setup authorization err: %v", err)
+	}
+	auditor, err = auditOptions.Logger()
+	if err != nil {
+		log.Fatalf("setup audit err: %v", err)
+	}
+	if _, err := redact.New(nil, redactPatterns); err != nil {
+		log.Fatalf("setup redaction err: %v", err)
+	}
+	commandPolicy, err = loadCommandPolicy()
+	if err != nil {
+		log.Fatalf("load command policy err: %v", err)
+	}
 	router := mux.NewRouter()
+	router.Use(auth.Middleware(authenticator))
 	router.PathPrefix("/debug/pprof/").Handler(http.DefaultServeMux)
 	// TODO
-	// temporarily use relative path, run by `go run cmd/webshell/webshell_main.go` in project root path.
+	// temporarily use relative path, run by `go run ./cmd/webshell` in project root path.
 	router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("./frontend/"))))
 	// enter webshell by url like: http://127.0.0.1:8090/terminal?namespace=default&pod=nginx-65f9798fbf-jdrgl&container=nginx
+	// debug distroless container with ephemeral container by appending &mode=debug
 	router.HandleFunc("/terminal", serveTerminal)
-	router.HandleFunc("/ws/{namespace}/{pod}/{container}/webshell", serveWsTerminal)
+	router.HandleFunc("/ws/{namespace}/{pod}/{container}/webshell", terminalHandler("exec", runExec))
+	// attach to container main process by url like: http://127.0.0.1:8090/terminal?namespace=default&pod=repl-0&container=repl&mode=attach
+	router.HandleFunc("/ws/{namespace}/{pod}/{container}/attach", terminalHandler("attach", runAttach))
+	// shell on node by url like: http://127.0.0.1:8090/terminal?node=worker-1
+	router.HandleFunc("/ws/node/{node}/webshell", serveWsNodeShell)
+	// watch live session by url like: http://127.0.0.1:8090/terminal?watch=7f1c0e...
+	router.HandleFunc("/ws/sessions/{id}/watch", serveWsWatch)
+	router.HandleFunc("/ws/sessions/{id}/resume", serveWsResume)
 	router.HandleFunc("/logs", serveLogs)
+	// aggregated logs of workload by url like: http://127.0.0.1:8090/logs?namespace=default&deployment=nginx&follow=true
+	// must be registered before per container logs, which matches the same path.
+	router.HandleFunc("/ws/{namespace}/{kind:deployment|statefulset}/{name}/logs", serveWsWorkloadLogs)
+	router.HandleFunc("/ws/{namespace}/logs", serveWsWorkloadLogs)
 	router.HandleFunc("/ws/{namespace}/{pod}/{container}/logs", serveWsLogs)
+	// admin api
+	router.HandleFunc("/admin/sessions", adminOnly(serveAdminSessions)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/sessions/{id}", adminOnly(serveAdminSession)).Methods(http.MethodGet, http.MethodDelete)
+	router.HandleFunc("/admin/limits", adminOnly(serveAdminLimits)).Methods(http.MethodGet)
+	// replay recording by url like: http://127.0.0.1:8090/terminal?recording=7f1c0e...
+	router.HandleFunc("/recordings", serveRecordings)
+	router.HandleFunc("/recordings/{id}", serveRecording)
+	router.HandleFunc("/ws/recordings/{id}/play", serveWsReplay)
 	server := http.Server{
 		Addr:         *addr,
 		ReadTimeout:  1 * time.Second,
@@ -8,6 +8,18 @@ function getQueryVariable(variable) {
 	return(false);
 }
 
+// forwardQuery return all params of page query in names, including repeated ones.
+function forwardQuery(names) {
+	let query = window.location.search.substring(1);
+	let forwarded = "";
+	for (let pair of query.split("&")) {
+		if (names.includes(pair.split("=")[0])) {
+			forwarded = forwarded+"&"+pair
+		}
+	}
+	return forwarded
+}
+
 function connect(){
 	namespace=getQueryVariable("namespace")
 	pod=getQueryVariable("pod")
@@ -17,18 +29,49 @@ function connect(){
 	if (namespace == false) {
 		namespace="default"
 	}
+	deployment=getQueryVariable("deployment")
+	statefulset=getQueryVariable("statefulset")
+	selector=getQueryVariable("selector")
 	// container_name="nginx-2"
-	if (namespace == false || pod == false) {
+	if (deployment != false) {
+		url = "ws://"+document.location.host+"/ws/"+namespace+"/deployment/"+deployment+"/logs?"
+	} else if (statefulset != false) {
+		url = "ws://"+document.location.host+"/ws/"+namespace+"/statefulset/"+statefulset+"/logs?"
+	} else if (selector != false) {
+		url = "ws://"+document.location.host+"/ws/"+namespace+"/logs?selector="+selector
+	} else if (pod == false) {
 		alert("cannot get pod")
 		return
+	} else {
+		url = "ws://"+document.location.host+"/ws/"+namespace+"/"+pod+"/"+container_name+"/logs?"
+	}
+	// aggregated logs of workload, container is optional.
+	if (pod == false && container_name != false) {
+		url = url+"&container="+container_name
+	}
+	order=getQueryVariable("order")
+	if (order != false) {
+		url = url+"&order="+order
 	}
-	url = "ws://"+document.location.host+"/ws/"+namespace+"/"+pod+"/"+container_name+"/logs?"
 	if (tail != false) {
 		url = url+"&tail="+tail
 	}
 	if (follow != false) {
 		url = url+"&follow="+follow
 	}
+	// log options and line filters passed through to the log request, grep and exclude could be repeated.
+	url = url+forwardQuery(["sinceSeconds", "sinceTime", "timestamps", "previous", "limitBytes", "insecureSkipTLSVerifyBackend",
+		"grep", "exclude", "ignoreCase", "before", "after", "context", "highlight", "level"])
+	// keep following across container restarts and rollouts.
+	resilient=getQueryVariable("resilient")
+	if (resilient != false) {
+		url = url+"&resilient="+resilient
+	}
+	// browsers could not set Authorization header on websocket requests.
+	accessToken = getQueryVariable("access_token")
+	if (accessToken != false) {
+		url = url+"&access_token="+accessToken
+	}
 
 	console.log(url);
 	let term = new Terminal({
@@ -39,19 +82,48 @@ function connect(){
 		// term.write("logs "+ pod + "...");
 		term.toggleFullScreen(true);
 		term.fit();
+		// keys control the stream: space pause/resume, s download snapshot.
+		var paused = false
 		term.on('data', function (data) {
-			conn.send(data)
+			if (data === " ") {
+				paused = !paused
+				sendControl({operation: paused ? "pause" : "resume"})
+			} else if (data === "s") {
+				sendControl({operation: "snapshot"})
+			}
 		});
-		conn = new WebSocket(url);
+		// typed frames, see Protocol in pkg/kube/log.
+		conn = new WebSocket(url, ["logs.kubeutil.io"]);
 		conn.onopen = function(e) {
 		};
 		conn.onmessage = function(event) {
-			term.writeln(event.data)
-			// term.write(event.data)
+			if (conn.protocol !== "logs.kubeutil.io") {
+				term.writeln(event.data)
+				return
+			}
+			let frame = JSON.parse(event.data)
+			switch (frame.type) {
+			case "line":
+				term.writeln(frame.data)
+				break
+			case "status":
+				term.writeln("\x1b[33m[" + frame.data + "]\x1b[0m")
+				break
+			case "error":
+				term.writeln("\x1b[31m" + frame.data + "\x1b[0m")
+				break
+			case "snapshot":
+				download(frame.name, frame.data)
+				break
+			}
 		};
 		conn.onclose = function(event) {
 			if (event.wasClean) {
 				console.log(`[close] Connection closed cleanly, code=${event.code} reason=${event.reason}`);
+				// denied by server, e.g. forbidden
+				if (event.code === 1008) {
+					term.write("\r\n\x1b[31m"+event.reason+"\x1b[0m")
+				}
 			} else {
 				console.log('[close] Connection died');
 				term.writeln("")
@@ -68,3 +140,19 @@ function connect(){
 		item.innerHTML = "<h2>Your browser does not support WebSockets.</h2>";
 	}
 }
+
+// sendControl send control to log websocket, e.g. {operation: "filter", filter: {include: ["err"]}},
+// {operation: "restream", options: {follow: true, tail: 100}} or {operation: "container", container: "app"}.
+function sendControl(control) {
+	if (conn && conn.readyState === WebSocket.OPEN) {
+		conn.send(JSON.stringify(control))
+	}
+}
+
+function download(name, data) {
+	let link = document.createElement("a")
+	link.href = URL.createObjectURL(new Blob([data], {type: "text/plain"}))
+	link.download = name
+	link.click()
+	URL.revokeObjectURL(link.href)
+}
@@ -10,17 +10,104 @@ function getQueryVariable(variable) {
 	return(false);
 }
 
+// binary protocol, see pkg/terminal/websocket/protocol.go
+const BINARY_PROTOCOL = "binary.terminal.kubeutil.io"
+const STDIN_CHANNEL = 0, STDOUT_CHANNEL = 1, STDERR_CHANNEL = 2, STATUS_CHANNEL = 3, RESIZE_CHANNEL = 4, CONTROL_CHANNEL = 255
+
+// newConn open websocket preferring binary protocol, falls back to json if server does not support it.
+// returned conn.sendMessage and conn.decodeMessage translate between protocols and message objects.
+function newConn(url) {
+	// browsers could not set Authorization header on websocket requests.
+	let accessToken = getQueryVariable("access_token")
+	if (accessToken != false) {
+		url = url+(url.includes("?") ? "&" : "?")+"access_token="+accessToken
+	}
+	let conn = new WebSocket(url, [BINARY_PROTOCOL])
+	conn.binaryType = "arraybuffer"
+	let encoder = new TextEncoder()
+	// streaming decoders keep multi-byte characters split across frames.
+	let stdoutDecoder = new TextDecoder()
+	let stderrDecoder = new TextDecoder()
+	conn.sendMessage = function(msg) {
+		if (conn.protocol !== BINARY_PROTOCOL) {
+			conn.send(JSON.stringify(msg))
+			return
+		}
+		let channel, payload
+		if (msg.operation === "stdin") {
+			channel = STDIN_CHANNEL
+			payload = encoder.encode(msg.data)
+		} else if (msg.operation === "resize") {
+			channel = RESIZE_CHANNEL
+			payload = encoder.encode(JSON.stringify({Width: msg.cols, Height: msg.rows}))
+		} else {
+			channel = CONTROL_CHANNEL
+			payload = encoder.encode(JSON.stringify(msg))
+		}
+		let buf = new Uint8Array(payload.length + 1)
+		buf[0] = channel
+		buf.set(payload, 1)
+		conn.send(buf)
+	}
+	// output messages carry the number of output bytes in msg.bytes, to resume from.
+	conn.decodeMessage = function(data) {
+		if (typeof data === "string") {
+			let msg = JSON.parse(data)
+			if (msg.operation === "stdout" || msg.operation === "stderr") {
+				msg.bytes = encoder.encode(msg.data).length
+			}
+			return msg
+		}
+		let buf = new Uint8Array(data)
+		let payload = buf.subarray(1)
+		if (buf[0] === STDOUT_CHANNEL) {
+			return {operation: "stdout", data: stdoutDecoder.decode(payload, {stream: true}), bytes: payload.length}
+		} else if (buf[0] === STDERR_CHANNEL) {
+			return {operation: "stderr", data: stderrDecoder.decode(payload, {stream: true}), bytes: payload.length}
+		}
+		return JSON.parse(new TextDecoder().decode(payload))
+	}
+	return conn
+}
+
 function connect(){
+	recording=getQueryVariable("recording")
+	if (recording != false) {
+		replay(recording)
+		return
+	}
+	watching=getQueryVariable("watch")
+	if (watching != false) {
+		watch(watching)
+		return
+	}
+	node=getQueryVariable("node")
 	namespace=getQueryVariable("namespace")
 	pod=getQueryVariable("pod")
 	container=getQueryVariable("container")
 	console.log(namespace ,pod ,container)
-	if (namespace == false || pod == false || container == false) {
+	if (node == false && (namespace == false || pod == false || container == false)) {
 		alert("无法获取到容器，请联系管理员")
 		return
 	}
 	console.log(namespace ,pod ,container)
 	url = "ws://"+document.location.host+"/ws/"+namespace+"/"+pod+"/"+container+"/webshell"
+	if (node != false) {
+		url = "ws://"+document.location.host+"/ws/node/"+node+"/webshell"
+		pod = "node "+node
+	} else if (getQueryVariable("mode") === "attach") {
+		url = "ws://"+document.location.host+"/ws/"+namespace+"/"+pod+"/"+container+"/attach"
+	}
+	params = []
+	for (const key of ["shell", "mode", "target"]) {
+		value = getQueryVariable(key)
+		if (value != false) {
+			params.push(key+"="+value)
+		}
+	}
+	if (params.length > 0) {
+		url = url+"?"+params.join("&")
+	}
 	console.log(url);
 	let term = new Terminal({
 		"cursorBlink":true,
@@ -28,47 +115,201 @@ function connect(){
 	if (window["WebSocket"]) {
 		term.open(document.getElementById("terminal"));
 		term.write("connecting to pod "+ pod + "...")
+		let exited = false
 		window.addEventListener('resize', () => term.fit());
 
 		term.on('data', function (data) {
 			msg = {operation: "stdin", data: data}
-			conn.send(JSON.stringify(msg))
+			conn.sendMessage(msg)
 		});
 		term.on('resize', function (size) {
 			console.log("resize: " + size.cols + " x " + size.rows);
 			msg = {operation: "resize", cols: size.cols, rows: size.rows}
-			conn.send(JSON.stringify(msg))
+			conn.sendMessage(msg)
+		});
+
+		// resume session with token after connection dropped, from the received output offset.
+		let session = "", token = "", received = 0, retries = 0
+		const maxRetries = 5
+
+		let open = function(url) {
+			conn = newConn(url);
+			conn.onopen = function(e) {
+				retries = 0
+				term.write("\r");
+				term.fit();
+				term.focus();
+			};
+			conn.onmessage = function(event) {
+				msg = conn.decodeMessage(event.data)
+				if (msg.operation === "stdout") {
+					received += msg.bytes
+					term.write(msg.data)
+				} else if (msg.operation === "stderr") {
+					received += msg.bytes
+					term.write("\x1b[31m"+msg.data+"\x1b[0m")
+				} else if (msg.operation === "token") {
+					token = msg.data
+				} else if (msg.operation === "exit") {
+					exited = true
+					let code = msg.code ? msg.code : 0
+					term.writeln("")
+					term.write("\x1b[2m[session ended with code "+code+": "+msg.data+"]\x1b[0m")
+				} else if (msg.operation === "warning") {
+					term.write("\r\n\x1b[33m["+msg.data+"]\x1b[0m\r\n")
+				} else if (msg.operation === "session") {
+					session = msg.data
+					console.log("watch this session: http://"+document.location.host+"/terminal?watch="+msg.data)
+				} else if (msg.operation === "watcher") {
+					console.log("watcher joined: "+msg.data+", hand control over by conn.sendMessage({operation: \"handoff\", data: \""+msg.data+"\"})")
+				} else if (msg.operation === "control") {
+					console.log("control handed to: "+(msg.data ? msg.data : "owner"))
+				} else {
+					console.log("invalid msg operation: "+msg)
+				}
+			};
+			conn.onclose = function(event) {
+				if (event.wasClean) {
+					console.log(`[close] Connection closed cleanly, code=${event.code} reason=${event.reason}`);
+					// denied by server, e.g. forbidden
+					if (event.code === 1008) {
+						term.write("\r\n\x1b[31m"+event.reason+"\x1b[0m")
+					}
+				} else {
+					console.log('[close] Connection died');
+					if (!exited && token !== "" && retries < maxRetries) {
+						retries++
+						term.write("\r\n\x1b[2m[connection lost, reconnecting ("+retries+"/"+maxRetries+")...]\x1b[0m\r\n")
+						setTimeout(function() {
+							open("ws://"+document.location.host+"/ws/sessions/"+session+"/resume?token="+token+"&offset="+received)
+						}, 1000 * retries)
+						return
+					}
+					term.writeln("")
+				}
+				if (!exited) {
+					term.write('Connection Reset By Peer! Try Refresh.');
+				}
+			};
+			conn.onerror = function(error) {
+				console.log('[error] Connection error');
+			};
+		}
+		open(url)
+	} else {
+		var item = document.getElementById("terminal");
+		item.innerHTML = "<h2>Your browser does not support WebSockets.</h2>";
+	}
+}
+
+// replay recorded session, keys: space pause/resume, +/- speed up/down, left/right seek 5s.
+function replay(recording){
+	url = "ws://"+document.location.host+"/ws/recordings/"+recording+"/play"
+	console.log(url);
+	let term = new Terminal({
+		"cursorBlink":false,
+	});
+	if (window["WebSocket"]) {
+		term.open(document.getElementById("terminal"));
+		term.write("loading recording "+ recording + "...\r\n")
+		let paused = false
+		let speed = 1
+		term.on('data', function (data) {
+			let msg
+			if (data === " ") {
+				paused = !paused
+				msg = {operation: paused ? "pause" : "resume"}
+			} else if (data === "+" || data === "-") {
+				speed = data === "+" ? Math.min(speed*2, 64) : Math.max(speed/2, 0.25)
+				msg = {operation: "speed", data: String(speed)}
+			} else if (data === "\x1b[C" || data === "\x1b[D") {
+				msg = {operation: "seek", data: data === "\x1b[C" ? "+5" : "-5"}
+			} else {
+				return
+			}
+			conn.sendMessage(msg)
 		});
 
-		conn = new WebSocket(url);
+		conn = newConn(url);
 		conn.onopen = function(e) {
-			term.write("\r");
-			msg = {operation: "stdin", data: "export TERM=xterm && clear \r"}
-			conn.send(JSON.stringify(msg))
-			term.fit();
 			term.focus();
 		};
 		conn.onmessage = function(event) {
-			msg = JSON.parse(event.data)
+			msg = conn.decodeMessage(event.data)
 			if (msg.operation === "stdout") {
 				term.write(msg.data)
+			} else if (msg.operation === "resize") {
+				term.resize(msg.cols, msg.rows)
 			} else {
 				console.log("invalid msg operation: "+msg)
 			}
 		};
 		conn.onclose = function(event) {
-			if (event.wasClean) {
-				console.log(`[close] Connection closed cleanly, code=${event.code} reason=${event.reason}`);
-			} else {
-				console.log('[close] Connection died');
+			console.log(`[close] Connection closed, code=${event.code} reason=${event.reason}`);
+			term.writeln("")
+			term.write(event.reason ? event.reason : 'Connection Reset By Peer! Try Refresh.');
+		};
+		conn.onerror = function(error) {
+			console.log('[error] Connection error');
+			term.write("error: "+error.message);
+		};
+	} else {
+		var item = document.getElementById("terminal");
+		item.innerHTML = "<h2>Your browser does not support WebSockets.</h2>";
+	}
+}
+
+// watch live session read-only, input is sent only after control is handed over.
+function watch(session){
+	url = "ws://"+document.location.host+"/ws/sessions/"+session+"/watch"
+	console.log(url);
+	let term = new Terminal({
+		"cursorBlink":true,
+	});
+	if (window["WebSocket"]) {
+		term.open(document.getElementById("terminal"));
+		term.write("watching session "+ session + "...\r\n")
+		let self = ""
+		let inControl = false
+		term.on('data', function (data) {
+			if (inControl) {
+				msg = {operation: "stdin", data: data}
+				conn.sendMessage(msg)
+			}
+		});
+
+		conn = newConn(url);
+		conn.onopen = function(e) {
+			term.focus();
+		};
+		conn.onmessage = function(event) {
+			msg = conn.decodeMessage(event.data)
+			if (msg.operation === "stdout") {
+				term.write(msg.data)
+			} else if (msg.operation === "stderr") {
+				term.write("\x1b[31m"+msg.data+"\x1b[0m")
+			} else if (msg.operation === "exit") {
 				term.writeln("")
+				term.write("\x1b[2m[session ended with code "+(msg.code ? msg.code : 0)+": "+msg.data+"]\x1b[0m")
+			} else if (msg.operation === "warning") {
+				term.write("\r\n\x1b[33m["+msg.data+"]\x1b[0m\r\n")
+			} else if (msg.operation === "watcher") {
+				self = msg.data
+			} else if (msg.operation === "control") {
+				inControl = msg.data === self
+				console.log("control handed to: "+(msg.data ? msg.data : "owner"))
+			} else {
+				console.log("invalid msg operation: "+msg)
 			}
-			term.write('Connection Reset By Peer! Try Refresh.');
+		};
+		conn.onclose = function(event) {
+			console.log(`[close] Connection closed, code=${event.code} reason=${event.reason}`);
+			term.writeln("")
+			term.write(event.reason ? event.reason : 'Connection Reset By Peer! Try Refresh.');
 		};
 		conn.onerror = function(error) {
 			console.log('[error] Connection error');
 			term.write("error: "+error.message);
-			term.destroy();
 		};
 	} else {
 		var item = document.getElementById("terminal");
@@ -0,0 +1,123 @@
+package audit
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/maoqide/kubeutil/pkg/auth"
+)
+
+// event types
+const (
+	// SessionStart terminal session started
+	SessionStart = "session.start"
+	// SessionEnd terminal session ended, with exit code and duration
+	SessionEnd = "session.end"
+	// SessionClose terminal session force closed by admin
+	SessionClose = "session.close"
+	// LogsOpen log stream opened
+	LogsOpen = "logs.open"
+	// FileDownload file copied out of container, with path and size
+	FileDownload = "file.download"
+	// AuthorizationDenied request denied by authorizer
+	AuthorizationDenied = "authorization.denied"
+	// CommandDenied command line in terminal session violated command policy, with action taken
+	CommandDenied = "command.denied"
+)
+
+// Event is a single audit record, written as one json line.
+type Event struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	User      string    `json:"user,omitempty"`
+	Groups    []string  `json:"groups,omitempty"`
+	SourceIP  string    `json:"sourceIP,omitempty"`
+	Namespace string    `json:"namespace,omitempty"`
+	Pod       string    `json:"pod,omitempty"`
+	Container string    `json:"container,omitempty"`
+	Node      string    `json:"node,omitempty"`
+	// Workload of aggregated logs, e.g. deployment/nginx
+	Workload  string `json:"workload,omitempty"`
+	SessionID string `json:"sessionID,omitempty"`
+	// Action e.g. exec, attach, debug
+	Action string `json:"action,omitempty"`
+	// Path of downloaded file
+	Path string `json:"path,omitempty"`
+	// Command line denied by command policy
+	Command string `json:"command,omitempty"`
+	// Bytes downloaded
+	Bytes    int64  `json:"bytes,omitempty"`
+	ExitCode *int   `json:"exitCode,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	// Duration of session in seconds
+	Duration float64 `json:"duration,omitempty"`
+}
+
+// FromRequest return event of type with user and source ip of r filled.
+func FromRequest(r *http.Request, eventType string) Event {
+	e := Event{Type: eventType, SourceIP: sourceIP(r.RemoteAddr)}
+	if user, ok := auth.UserFrom(r.Context()); ok {
+		e.User = user.Name
+		e.Groups = user.Groups
+	}
+	return e
+}
+
+func sourceIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+// Sink writes audit events somewhere.
+type Sink interface {
+	Write(e Event) error
+	Close() error
+}
+
+// Logger writes audit events to all its sinks. It is safe for concurrent use,
+// a Logger without sinks discards events.
+type Logger struct {
+	mu    sync.Mutex
+	sinks []Sink
+}
+
+// New create Logger writing to sinks.
+func New(sinks ...Sink) *Logger {
+	return &Logger{sinks: sinks}
+}
+
+// Log write e to all sinks, Time is set if zero. failures are logged, never returned,
+// the audited operation goes on.
+func (l *Logger) Log(e Event) {
+	if l == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, s := range l.sinks {
+		if err := s.Write(e); err != nil {
+			log.Printf("write audit event %s err: %v", e.Type, err)
+		}
+	}
+}
+
+// Close close all sinks.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var errs []error
+	for _, s := range l.sinks {
+		errs = append(errs, s.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,66 @@
+package audit_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/maoqide/kubeutil/pkg/audit"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := audit.New(audit.NewWriterSink(&buf))
+	code := 0
+	logger.Log(audit.Event{Type: audit.SessionEnd, User: "alice", Pod: "nginx", ExitCode: &code})
+
+	var e audit.Event
+	if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+		t.Fatalf("decode event err: %v", err)
+	}
+	if e.Type != audit.SessionEnd || e.User != "alice" || e.ExitCode == nil || *e.ExitCode != 0 || e.Time.IsZero() {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+	// nil logger discards events
+	var discard *audit.Logger
+	discard.Log(e)
+}
+
+func TestFileSinkRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := audit.NewFileSink(path, 200, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := sink.Write(audit.Event{Type: audit.LogsOpen, Pod: "nginx"}); err != nil {
+			t.Fatalf("write event err: %v", err)
+		}
+	}
+	sink.Close()
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatalf("open %s err: %v", name, err)
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var e audit.Event
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+				t.Fatalf("%s: invalid line %q", name, scanner.Text())
+			}
+		}
+		f.Close()
+		info, _ := os.Stat(name)
+		if info.Size() > 200 {
+			t.Fatalf("%s exceeds max size: %d", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("expected at most 2 backups, err: %v", err)
+	}
+}
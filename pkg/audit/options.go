@@ -0,0 +1,43 @@
+package audit
+
+import (
+	"flag"
+	"os"
+)
+
+// Options configures audit sinks of a server.
+type Options struct {
+	File           string
+	FileMaxSize    int64
+	FileMaxBackups int
+	Stdout         bool
+	Webhook        string
+}
+
+// AddFlags register flags of o to fs.
+func (o *Options) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.File, "audit-file", "", "file to write audit events as json lines")
+	fs.Int64Var(&o.FileMaxSize, "audit-file-max-size", 100, "rotate audit file when it exceeds this many megabytes, 0 to disable")
+	fs.IntVar(&o.FileMaxBackups, "audit-file-max-backups", 10, "rotated audit files to keep")
+	fs.BoolVar(&o.Stdout, "audit-stdout", false, "write audit events to stdout")
+	fs.StringVar(&o.Webhook, "audit-webhook", "", "url to post audit events to")
+}
+
+// Logger build Logger writing to sinks configured by o.
+func (o *Options) Logger() (*Logger, error) {
+	var sinks []Sink
+	if o.File != "" {
+		s, err := NewFileSink(o.File, o.FileMaxSize*1024*1024, o.FileMaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	if o.Stdout {
+		sinks = append(sinks, NewWriterSink(os.Stdout))
+	}
+	if o.Webhook != "" {
+		sinks = append(sinks, NewWebhookSink(o.Webhook))
+	}
+	return New(sinks...), nil
+}
@@ -0,0 +1,197 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// WriterSink writes events as json lines to w, e.g. os.Stdout.
+type WriterSink struct {
+	w io.Writer
+}
+
+// NewWriterSink create WriterSink.
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+// Write write e as a json line.
+func (s *WriterSink) Write(e Event) error {
+	return json.NewEncoder(s.w).Encode(e)
+}
+
+// Close does nothing, w is owned by caller.
+func (s *WriterSink) Close() error {
+	return nil
+}
+
+// FileSink writes events as json lines to file, rotated when it exceeds MaxSize.
+// rotated files are named path.1 (newest) to path.N, at most MaxBackups are kept.
+type FileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewFileSink create FileSink appending to path, maxSize 0 disables rotation.
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	s := &FileSink{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file, s.size = f, info.Size()
+	return nil
+}
+
+// Write append e as a json line, rotating the file first if needed.
+func (s *FileSink) Write(e Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+// rotate shift backups and start a new file, must be called with mu held.
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	s.file = nil
+	if s.maxBackups > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", s.path, s.maxBackups))
+		for i := s.maxBackups - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+		}
+		if err := os.Rename(s.path, s.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(s.path); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+// Close close the file.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+const (
+	webhookTimeout   = 10 * time.Second
+	webhookQueueSize = 1024
+)
+
+// WebhookSink posts each event as json to url in background.
+// events are dropped when the queue is full, so that a slow webhook never blocks operations.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+	queue  chan Event
+	done   chan struct{}
+}
+
+// NewWebhookSink create WebhookSink posting to url.
+func NewWebhookSink(url string) *WebhookSink {
+	s := &WebhookSink{
+		url:    url,
+		client: &http.Client{Timeout: webhookTimeout},
+		queue:  make(chan Event, webhookQueueSize),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Write queue e to be posted.
+func (s *WebhookSink) Write(e Event) error {
+	select {
+	case s.queue <- e:
+		return nil
+	default:
+		return fmt.Errorf("webhook queue full, event dropped")
+	}
+}
+
+func (s *WebhookSink) run() {
+	defer close(s.done)
+	for e := range s.queue {
+		if err := s.post(e); err != nil {
+			log.Printf("post audit event %s err: %v", e.Type, err)
+		}
+	}
+}
+
+func (s *WebhookSink) post(e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, s.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// Close post queued events and stop.
+func (s *WebhookSink) Close() error {
+	close(s.queue)
+	<-s.done
+	return nil
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// AccessTokenParam query param carrying bearer token, as browsers could not set headers on websocket requests.
+const AccessTokenParam = "access_token"
+
+// User is the authenticated identity of a request.
+type User struct {
+	Name   string   `json:"name"`
+	UID    string   `json:"uid,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+}
+
+// Authenticator authenticates a request.
+// ok is false without error if the request carries no credential the authenticator understands.
+type Authenticator interface {
+	Authenticate(r *http.Request) (user *User, ok bool, err error)
+}
+
+// AuthenticatorFunc adapts function to Authenticator.
+type AuthenticatorFunc func(r *http.Request) (*User, bool, error)
+
+// Authenticate call f(r).
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (*User, bool, error) {
+	return f(r)
+}
+
+// Chain tries authenticators in order, the first one authenticated the request wins.
+type Chain []Authenticator
+
+// Authenticate authenticate r with authenticators in chain, errors are returned only if none succeeded.
+func (c Chain) Authenticate(r *http.Request) (*User, bool, error) {
+	var errs []error
+	for _, a := range c {
+		user, ok, err := a.Authenticate(r)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if ok {
+			return user, true, nil
+		}
+	}
+	return nil, false, errors.Join(errs...)
+}
+
+// Anonymous authenticate every request as system:anonymous, put it last in chain.
+var Anonymous = AuthenticatorFunc(func(r *http.Request) (*User, bool, error) {
+	return &User{Name: "system:anonymous", Groups: []string{"system:unauthenticated"}}, true, nil
+})
+
+type contextKey struct{}
+
+// WithUser return ctx carrying user.
+func WithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+// UserFrom return user authenticated by Middleware from ctx.
+func UserFrom(ctx context.Context) (*User, bool) {
+	user, ok := ctx.Value(contextKey{}).(*User)
+	return user, ok
+}
+
+// Middleware authenticate every request with a before passing it on with user in context,
+// unauthenticated requests are rejected with 401.
+func Middleware(a Authenticator) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok, err := a.Authenticate(r)
+			if err != nil {
+				log.Printf("authenticate %s %s from %s err: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+			}
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="kubeutil"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
+		})
+	}
+}
+
+// BearerToken return bearer token in Authorization header or query param access_token.
+func BearerToken(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); h != "" {
+		if token, ok := strings.CutPrefix(h, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	return r.URL.Query().Get(AccessTokenParam)
+}
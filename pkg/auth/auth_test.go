@@ -0,0 +1,95 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maoqide/kubeutil/pkg/auth"
+)
+
+func TestStaticTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.csv")
+	content := "# comment\nsecret,alice,1,\"ops,dev\"\nother,bob,2\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := auth.LoadTokenFile(path)
+	if err != nil {
+		t.Fatalf("load token file err: %v", err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/terminal", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	user, ok, err := tokens.Authenticate(r)
+	if err != nil || !ok || user.Name != "alice" || len(user.Groups) != 2 {
+		t.Fatalf("unexpected user: %+v, ok: %v, err: %v", user, ok, err)
+	}
+	r = httptest.NewRequest(http.MethodGet, "/ws/default/nginx/nginx/webshell?access_token=other", nil)
+	if user, ok, _ := tokens.Authenticate(r); !ok || user.Name != "bob" {
+		t.Fatalf("unexpected user by query token: %+v", user)
+	}
+	r = httptest.NewRequest(http.MethodGet, "/terminal?access_token=wrong", nil)
+	if _, ok, _ := tokens.Authenticate(r); ok {
+		t.Fatal("expected wrong token not authenticated")
+	}
+}
+
+func TestRequestHeader(t *testing.T) {
+	h, err := auth.NewRequestHeader("X-Remote-User", "X-Remote-Group", "10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/terminal", nil)
+	r.Header.Set("X-Remote-User", "alice")
+	r.Header.Add("X-Remote-Group", "ops, dev")
+	r.RemoteAddr = "10.1.2.3:5678"
+	if user, ok, _ := h.Authenticate(r); !ok || user.Name != "alice" || len(user.Groups) != 2 {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+	r.RemoteAddr = "192.168.1.1:5678"
+	if _, ok, _ := h.Authenticate(r); ok {
+		t.Fatal("expected header from untrusted address ignored")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	chain := auth.Chain{auth.NewStaticTokens(map[string]*auth.User{"secret": {Name: "alice"}})}
+	handler := auth.Middleware(chain)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := auth.UserFrom(r.Context())
+		w.Write([]byte(user.Name))
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/terminal", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/terminal?access_token=secret", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "alice" {
+		t.Fatalf("unexpected response: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	authorizer := auth.AuthorizerFunc(func(ctx context.Context, user *auth.User, attrs auth.Attributes) (bool, string, error) {
+		return user.Name == "alice" && attrs.Subresource == "log", "no RBAC policy matched", nil
+	})
+	attrs := auth.Attributes{Verb: "create", Resource: "pods", Subresource: "exec", Namespace: "default", Name: "nginx"}
+	ctx := auth.WithUser(context.Background(), &auth.User{Name: "alice"})
+	err := auth.Authorize(ctx, authorizer, attrs)
+	if err == nil || !strings.Contains(err.Error(), "pods/exec") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	attrs.Verb, attrs.Subresource = "get", "log"
+	if err := auth.Authorize(ctx, authorizer, attrs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := auth.Authorize(context.Background(), authorizer, attrs); err == nil {
+		t.Fatal("expected unauthenticated request denied")
+	}
+}
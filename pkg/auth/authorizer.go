@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Attributes of a request to authorize, same as ResourceAttributes of SubjectAccessReview.
+type Attributes struct {
+	Verb        string
+	Group       string
+	Resource    string
+	Subresource string
+	Namespace   string
+	Name        string
+}
+
+func (a Attributes) String() string {
+	resource := a.Resource
+	if a.Subresource != "" {
+		resource += "/" + a.Subresource
+	}
+	if a.Namespace != "" {
+		return fmt.Sprintf("%s %s %s in namespace %s", a.Verb, resource, a.Name, a.Namespace)
+	}
+	return fmt.Sprintf("%s %s %s", a.Verb, resource, a.Name)
+}
+
+// Authorizer decides whether user could perform the request described by attrs.
+type Authorizer interface {
+	Authorize(ctx context.Context, user *User, attrs Attributes) (allowed bool, reason string, err error)
+}
+
+// AuthorizerFunc adapts function to Authorizer.
+type AuthorizerFunc func(ctx context.Context, user *User, attrs Attributes) (bool, string, error)
+
+// Authorize call f.
+func (f AuthorizerFunc) Authorize(ctx context.Context, user *User, attrs Attributes) (bool, string, error) {
+	return f(ctx, user, attrs)
+}
+
+// AlwaysAllow allow every request, for development only.
+var AlwaysAllow = AuthorizerFunc(func(ctx context.Context, user *User, attrs Attributes) (bool, string, error) {
+	return true, "", nil
+})
+
+// SubjectAccessReview authorize requests with SubjectAccessReview against the cluster,
+// so that users are bound by cluster RBAC instead of the server's own permissions.
+type SubjectAccessReview struct {
+	clientset kubernetes.Interface
+}
+
+// NewSubjectAccessReview create SubjectAccessReview authorizer.
+func NewSubjectAccessReview(clientset kubernetes.Interface) *SubjectAccessReview {
+	return &SubjectAccessReview{clientset: clientset}
+}
+
+// Authorize authorize user to perform attrs.
+func (a *SubjectAccessReview) Authorize(ctx context.Context, user *User, attrs Attributes) (bool, string, error) {
+	review, err := a.clientset.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Name,
+			UID:    user.UID,
+			Groups: user.Groups,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Verb:        attrs.Verb,
+				Group:       attrs.Group,
+				Resource:    attrs.Resource,
+				Subresource: attrs.Subresource,
+				Namespace:   attrs.Namespace,
+				Name:        attrs.Name,
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return false, "", fmt.Errorf("subject access review: %v", err)
+	}
+	return review.Status.Allowed, review.Status.Reason, nil
+}
+
+// Authorize authorize user of ctx, authenticated by Middleware, to perform attrs with a.
+// returned error describes why the request is denied.
+func Authorize(ctx context.Context, a Authorizer, attrs Attributes) error {
+	user, ok := UserFrom(ctx)
+	if !ok {
+		return fmt.Errorf("unauthenticated user cannot %s", attrs)
+	}
+	allowed, reason, err := a.Authorize(ctx, user, attrs)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		msg := fmt.Sprintf("user %s cannot %s", user.Name, attrs)
+		if reason != "" {
+			msg += ": " + reason
+		}
+		return fmt.Errorf("forbidden: %s", msg)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RequestHeader trust user identity in headers set by an authenticating proxy,
+// only for requests coming from the proxy.
+type RequestHeader struct {
+	UserHeader  string
+	GroupHeader string
+	// Trusted networks of the proxy, headers of requests from elsewhere are ignored.
+	Trusted []*net.IPNet
+}
+
+// NewRequestHeader create RequestHeader trusting proxies in comma separated cidrs.
+func NewRequestHeader(userHeader, groupHeader, cidrs string) (*RequestHeader, error) {
+	h := &RequestHeader{UserHeader: userHeader, GroupHeader: groupHeader}
+	for _, cidr := range strings.Split(cidrs, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		h.Trusted = append(h.Trusted, ipNet)
+	}
+	if len(h.Trusted) == 0 {
+		return nil, fmt.Errorf("trusted proxy cidrs required for header %s", userHeader)
+	}
+	return h, nil
+}
+
+// Authenticate authenticate r by user header.
+func (h *RequestHeader) Authenticate(r *http.Request) (*User, bool, error) {
+	name := r.Header.Get(h.UserHeader)
+	if name == "" || !h.trusted(r.RemoteAddr) {
+		return nil, false, nil
+	}
+	user := &User{Name: name}
+	if h.GroupHeader != "" {
+		for _, value := range r.Header.Values(h.GroupHeader) {
+			for _, group := range strings.Split(value, ",") {
+				if group = strings.TrimSpace(group); group != "" {
+					user.Groups = append(user.Groups, group)
+				}
+			}
+		}
+	}
+	return user, true, nil
+}
+
+func (h *RequestHeader) trusted(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range h.Trusted {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
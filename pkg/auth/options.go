@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// authorization modes
+const (
+	ModeSubjectAccessReview = "SubjectAccessReview"
+	ModeAlwaysAllow         = "AlwaysAllow"
+)
+
+// Options configures the authenticator chain and the authorizer of a server.
+type Options struct {
+	TokenFile         string
+	TokenReview       bool
+	ProxyUserHeader   string
+	ProxyGroupHeader  string
+	ProxyTrustedCIDRs string
+	AllowAnonymous    bool
+	AuthorizationMode string
+}
+
+// AddFlags register flags of o to fs.
+func (o *Options) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.TokenFile, "token-file", "", "csv file of static bearer tokens: token,user,uid,\"group1,group2\"")
+	fs.BoolVar(&o.TokenReview, "token-review", false, "authenticate bearer tokens with TokenReview against the cluster")
+	fs.StringVar(&o.ProxyUserHeader, "proxy-user-header", "", "header carrying user name set by authenticating proxy, e.g. X-Remote-User")
+	fs.StringVar(&o.ProxyGroupHeader, "proxy-group-header", "X-Remote-Group", "header carrying user groups set by authenticating proxy")
+	fs.StringVar(&o.ProxyTrustedCIDRs, "proxy-trusted-cidrs", "", "comma separated cidrs of authenticating proxy, required with proxy-user-header")
+	fs.BoolVar(&o.AllowAnonymous, "allow-anonymous", false, "allow unauthenticated requests as system:anonymous")
+	fs.StringVar(&o.AuthorizationMode, "authorization-mode", ModeSubjectAccessReview, "authorize requests by SubjectAccessReview against the cluster, or AlwaysAllow for development")
+}
+
+// Authenticator build authenticator chain from o, clientset is used by TokenReview.
+func (o *Options) Authenticator(clientset kubernetes.Interface) (Authenticator, error) {
+	var chain Chain
+	if o.ProxyUserHeader != "" {
+		h, err := NewRequestHeader(o.ProxyUserHeader, o.ProxyGroupHeader, o.ProxyTrustedCIDRs)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, h)
+	}
+	if o.TokenFile != "" {
+		tokens, err := LoadTokenFile(o.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, tokens)
+	}
+	if o.TokenReview {
+		if clientset == nil {
+			return nil, errors.New("token review requires kubernetes clientset")
+		}
+		chain = append(chain, NewTokenReview(clientset))
+	}
+	if o.AllowAnonymous {
+		log.Println("WARNING: anonymous access allowed")
+		chain = append(chain, Anonymous)
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("no authenticator configured, set -allow-anonymous to allow unauthenticated access")
+	}
+	return chain, nil
+}
+
+// Authorizer build authorizer from o, clientset is used by SubjectAccessReview.
+func (o *Options) Authorizer(clientset kubernetes.Interface) (Authorizer, error) {
+	switch o.AuthorizationMode {
+	case ModeSubjectAccessReview:
+		if clientset == nil {
+			return nil, errors.New("subject access review requires kubernetes clientset")
+		}
+		return NewSubjectAccessReview(clientset), nil
+	case ModeAlwaysAllow:
+		log.Println("WARNING: all requests are authorized")
+		return AlwaysAllow, nil
+	default:
+		return nil, fmt.Errorf("unknown authorization mode '%s'", o.AuthorizationMode)
+	}
+}
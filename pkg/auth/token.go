@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// StaticTokens authenticate bearer tokens against a fixed token list.
+type StaticTokens struct {
+	// users by sha256 of token, so that lookup does not leak token by timing.
+	users map[[sha256.Size]byte]*User
+}
+
+// NewStaticTokens create StaticTokens from users by token.
+func NewStaticTokens(tokens map[string]*User) *StaticTokens {
+	s := &StaticTokens{users: make(map[[sha256.Size]byte]*User, len(tokens))}
+	for token, user := range tokens {
+		s.users[sha256.Sum256([]byte(token))] = user
+	}
+	return s
+}
+
+// LoadTokenFile load StaticTokens from csv file in the format of kube-apiserver --token-auth-file:
+// token,user,uid,"group1,group2"
+func LoadTokenFile(path string) (*StaticTokens, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseTokens(f)
+}
+
+func parseTokens(r io.Reader) (*StaticTokens, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	tokens := map[string]*User{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("token file line %d: expected token,user,uid[,groups]", line)
+		}
+		user := &User{Name: record[1], UID: record[2]}
+		if len(record) > 3 && record[3] != "" {
+			user.Groups = strings.Split(record[3], ",")
+		}
+		if record[0] == "" || user.Name == "" {
+			return nil, fmt.Errorf("token file line %d: empty token or user", line)
+		}
+		tokens[record[0]] = user
+	}
+	return NewStaticTokens(tokens), nil
+}
+
+// Authenticate authenticate bearer token of r.
+func (s *StaticTokens) Authenticate(r *http.Request) (*User, bool, error) {
+	token := BearerToken(r)
+	if token == "" {
+		return nil, false, nil
+	}
+	user, ok := s.users[sha256.Sum256([]byte(token))]
+	return user, ok, nil
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	defaultTokenReviewTTL     = time.Minute
+	defaultTokenReviewTimeout = 10 * time.Second
+)
+
+type tokenReviewResult struct {
+	user    *User
+	ok      bool
+	expires time.Time
+}
+
+// TokenReview authenticate bearer tokens, e.g. service account tokens, with TokenReview against the cluster.
+// results are cached for TTL.
+type TokenReview struct {
+	clientset kubernetes.Interface
+	// Audiences the token must be issued for, apiserver audiences if empty.
+	Audiences []string
+	TTL       time.Duration
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]tokenReviewResult
+}
+
+// NewTokenReview create TokenReview authenticator.
+func NewTokenReview(clientset kubernetes.Interface) *TokenReview {
+	return &TokenReview{
+		clientset: clientset,
+		TTL:       defaultTokenReviewTTL,
+		cache:     map[[sha256.Size]byte]tokenReviewResult{},
+	}
+}
+
+// Authenticate authenticate bearer token of r.
+func (a *TokenReview) Authenticate(r *http.Request) (*User, bool, error) {
+	token := BearerToken(r)
+	if token == "" {
+		return nil, false, nil
+	}
+	key := sha256.Sum256([]byte(token))
+	now := time.Now()
+	a.mu.Lock()
+	result, cached := a.cache[key]
+	a.mu.Unlock()
+	if cached && now.Before(result.expires) {
+		return result.user, result.ok, nil
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), defaultTokenReviewTimeout)
+	defer cancel()
+	review, err := a.clientset.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token, Audiences: a.Audiences},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, false, fmt.Errorf("token review: %v", err)
+	}
+	result = tokenReviewResult{expires: now.Add(a.TTL)}
+	if status := review.Status; status.Authenticated {
+		result.ok = true
+		result.user = &User{Name: status.User.Username, UID: status.User.UID, Groups: status.User.Groups}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// drop expired entries so that the cache does not grow without bound.
+	for k, v := range a.cache {
+		if now.After(v.expires) {
+			delete(a.cache, k)
+		}
+	}
+	a.cache[key] = result
+	return result.user, result.ok, nil
+}
@@ -7,7 +7,9 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8sruntime "k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 )
 
 var deletePolicy = metav1.DeletePropagationForeground
@@ -23,6 +25,7 @@ type Client struct {
 	*DeploymentBox
 	*ServiceBox
 	*StatefulSetBox
+	*SecretBox
 }
 
 // GetClient get all kube resource client.
@@ -32,14 +35,18 @@ func GetClient() (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
-	cli := Client{
-		&PodBox{clientset: *c, config: cfg},
-		&EventBox{clientset: *c},
-		&DeploymentBox{clientset: *c},
-		&ServiceBox{clientset: *c},
-		&StatefulSetBox{clientset: *c},
+	return newClient(*c, cfg), nil
+}
+
+func newClient(clientset kubernetes.Interface, cfg *rest.Config) *Client {
+	return &Client{
+		&PodBox{clientset: clientset, config: cfg},
+		&EventBox{clientset: clientset},
+		&DeploymentBox{clientset: clientset},
+		&ServiceBox{clientset: clientset},
+		&StatefulSetBox{clientset: clientset},
+		&SecretBox{clientset: clientset},
 	}
-	return &cli, nil
 }
 
 // DecodeKubeObj decode kubernetes object from yaml
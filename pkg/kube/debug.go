@@ -0,0 +1,120 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	patchtypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	terminal "github.com/maoqide/kubeutil/pkg/terminal"
+	"github.com/maoqide/kubeutil/utils"
+)
+
+const (
+	// DefaultDebugImage image of debug container if not specified
+	DefaultDebugImage = "busybox:1.36"
+
+	defaultDebugTimeout = 2 * time.Minute
+	debugPollInterval   = time.Second
+)
+
+// waiting reasons that debug container would never run
+var imagePullFailures = map[string]bool{
+	"ErrImagePull":     true,
+	"ImagePullBackOff": true,
+	"InvalidImageName": true,
+}
+
+// DebugOptions options for ephemeral debug container
+type DebugOptions struct {
+	// Image of debug container, DefaultDebugImage if empty.
+	Image string
+	// Command of debug container, image entrypoint is used if empty.
+	Command []string
+	// TargetContainer share process namespace with debug container, no sharing if empty.
+	TargetContainer string
+	// Timeout waiting for debug container running.
+	Timeout time.Duration
+}
+
+// Debug add an ephemeral debug container to pod and attach ptyHandler to it.
+// the ephemeral container could not be removed from pod, it terminates when its process exits.
+func (b *PodBox) Debug(ctx context.Context, opts DebugOptions, ptyHandler terminal.PtyHandler, namespace, podName string) error {
+	if opts.Image == "" {
+		opts.Image = DefaultDebugImage
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultDebugTimeout
+	}
+	pod, err := b.Get(ctx, podName, namespace)
+	if err != nil {
+		return err
+	}
+	ec := corev1.EphemeralContainer{
+		EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+			Name:                     fmt.Sprintf("debugger-%s", utils.NewID()[:5]),
+			Image:                    opts.Image,
+			Command:                  opts.Command,
+			ImagePullPolicy:          corev1.PullIfNotPresent,
+			TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+			Stdin:                    true,
+			TTY:                      ptyHandler.Tty(),
+		},
+		TargetContainerName: opts.TargetContainer,
+	}
+	if err := b.addEphemeralContainer(ctx, pod, ec); err != nil {
+		return err
+	}
+	if err := b.waitEphemeralContainerRunning(ctx, namespace, podName, ec.Name, opts.Timeout); err != nil {
+		return err
+	}
+	return b.AttachWithContext(ctx, ptyHandler, namespace, podName, ec.Name)
+}
+
+// addEphemeralContainer patch pod with ec through ephemeralcontainers subresource.
+func (b *PodBox) addEphemeralContainer(ctx context.Context, pod *corev1.Pod, ec corev1.EphemeralContainer) error {
+	podJSON, err := json.Marshal(pod)
+	if err != nil {
+		return err
+	}
+	debugPod := pod.DeepCopy()
+	debugPod.Spec.EphemeralContainers = append(debugPod.Spec.EphemeralContainers, ec)
+	debugJSON, err := json.Marshal(debugPod)
+	if err != nil {
+		return err
+	}
+	patch, err := strategicpatch.CreateTwoWayMergePatch(podJSON, debugJSON, pod)
+	if err != nil {
+		return err
+	}
+	_, err = b.clientset.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, patchtypes.StrategicMergePatchType, patch, metav1.PatchOptions{}, "ephemeralcontainers")
+	return err
+}
+
+func (b *PodBox) waitEphemeralContainerRunning(ctx context.Context, namespace, podName, containerName string, timeout time.Duration) error {
+	return wait.PollUntilContextTimeout(ctx, debugPollInterval, timeout, true, func(ctx context.Context) (bool, error) {
+		pod, err := b.Get(ctx, podName, namespace)
+		if err != nil {
+			return false, err
+		}
+		for _, s := range pod.Status.EphemeralContainerStatuses {
+			if s.Name != containerName {
+				continue
+			}
+			if s.State.Terminated != nil {
+				return false, fmt.Errorf("debug container %s terminated: %s", containerName, s.State.Terminated.Reason)
+			}
+			if w := s.State.Waiting; w != nil && imagePullFailures[w.Reason] {
+				return false, fmt.Errorf("debug container %s waiting: %s, %s", containerName, w.Reason, w.Message)
+			}
+			return s.State.Running != nil, nil
+		}
+		return false, nil
+	})
+}
@@ -160,8 +160,7 @@ func (b *DeploymentBox) GetPods(ctx context.Context, name, namespace string) (*c
 		return nil, err
 	}
 	opt := metav1.ListOptions{LabelSelector: labelSelector.String()}
-	podList, err := b.clientset.CoreV1().Pods(namespace).List(ctx, opt)
-	return podList, nil
+	return b.clientset.CoreV1().Pods(namespace).List(ctx, opt)
 }
 
 // PatchImage reutn bytes for a StrategicMergePatch of deployment
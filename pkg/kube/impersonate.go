@@ -0,0 +1,86 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/maoqide/kubeutil/pkg/auth"
+	kubeclient "github.com/maoqide/kubeutil/pkg/client"
+)
+
+// ImpersonationTTL how long impersonating clients are cached for an identity.
+var ImpersonationTTL = 10 * time.Minute
+
+type impersonatingClient struct {
+	client  *Client
+	expires time.Time
+}
+
+var (
+	impersonatingMu      sync.Mutex
+	impersonatingClients = map[string]impersonatingClient{}
+)
+
+// GetImpersonatingClient get kube resource client making every request as user,
+// so that requests are authorized and audited as the user instead of kubeutil itself.
+// clients are cached per identity for ImpersonationTTL.
+func GetImpersonatingClient(user rest.ImpersonationConfig) (*Client, error) {
+	key := impersonationKey(user)
+	now := time.Now()
+	impersonatingMu.Lock()
+	defer impersonatingMu.Unlock()
+	if c, ok := impersonatingClients[key]; ok && now.Before(c.expires) {
+		return c.client, nil
+	}
+	for k, c := range impersonatingClients {
+		if now.After(c.expires) {
+			delete(impersonatingClients, k)
+		}
+	}
+
+	base, err := kubeclient.Config()
+	if err != nil {
+		return nil, err
+	}
+	cfg := rest.CopyConfig(base)
+	cfg.Impersonate = user
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client := newClient(clientset, cfg)
+	impersonatingClients[key] = impersonatingClient{client: client, expires: now.Add(ImpersonationTTL)}
+	return client, nil
+}
+
+// GetRequestClient get kube client for a request, impersonating the user authenticated by auth.Middleware
+// in ctx if impersonate is true, otherwise the client of kubeutil itself.
+func GetRequestClient(ctx context.Context, impersonate bool) (*Client, error) {
+	if !impersonate {
+		return GetClient()
+	}
+	user, ok := auth.UserFrom(ctx)
+	if !ok {
+		return nil, errors.New("unauthenticated user")
+	}
+	return GetImpersonatingClient(rest.ImpersonationConfig{UserName: user.Name, UID: user.UID, Groups: user.Groups})
+}
+
+func impersonationKey(user rest.ImpersonationConfig) string {
+	groups := append([]string{}, user.Groups...)
+	sort.Strings(groups)
+	extra := make([]string, 0, len(user.Extra))
+	for k, v := range user.Extra {
+		extra = append(extra, k+"="+strings.Join(v, ","))
+	}
+	sort.Strings(extra)
+	// NUL never appears in user names, groups or extra.
+	return strings.Join([]string{user.UserName, user.UID, strings.Join(groups, "\x00"), strings.Join(extra, "\x00")}, "\x00\x00")
+}
@@ -0,0 +1,315 @@
+package log
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// OrderWindow is how long a line waits for lines of other sources with earlier timestamps
+// when Aggregator orders lines by timestamp.
+const OrderWindow = time.Second
+
+// prefixColors ansi colors of source prefixes, picked by source index.
+var prefixColors = []string{"\x1b[36m", "\x1b[33m", "\x1b[32m", "\x1b[35m", "\x1b[34m", "\x1b[31m", "\x1b[96m", "\x1b[93m", "\x1b[92m", "\x1b[95m"}
+
+// LogStreamer streams log of a container line by line, implemented by kube.PodBox.
+type LogStreamer interface {
+	LogStreamLine(ctx context.Context, name, namespace string, opts *corev1.PodLogOptions, writer io.Writer) error
+}
+
+// Source is a container to stream log of.
+type Source struct {
+	Pod       string
+	Container string
+}
+
+func (s Source) String() string {
+	return s.Pod + "/" + s.Container
+}
+
+// SourceWriter return writer of log lines of source to w, e.g. to redact or filter them.
+// lines are written one per write, without timestamp and prefix, it could drop lines or write more.
+// the writer is closed when the stream of source ends if it is an io.Closer.
+type SourceWriter func(source Source, w io.Writer) (io.Writer, error)
+
+// PodSources return sources of pods, all containers of each pod if container is empty.
+func PodSources(pods []corev1.Pod, container string) []Source {
+	var sources []Source
+	for _, pod := range pods {
+		for _, c := range pod.Spec.Containers {
+			if container == "" || c.Name == container {
+				sources = append(sources, Source{Pod: pod.Name, Container: c.Name})
+			}
+		}
+	}
+	return sources
+}
+
+// Aggregator streams log of multiple containers concurrently into one writer,
+// each line is prefixed by its pod/container.
+type Aggregator struct {
+	Streamer  LogStreamer
+	Namespace string
+	Sources   []Source
+	// Options for all sources, Container is overridden by source.
+	Options corev1.PodLogOptions
+	// Color color prefixes with ansi colors.
+	Color bool
+	// Order order lines of sources by timestamp, a line is delayed up to OrderWindow.
+	Order bool
+	// Lines wraps writer of lines of each source if set, a source fails if it returns error.
+	Lines SourceWriter
+}
+
+// logLine is a line from a source, or end of the source if end is true.
+type logLine struct {
+	source  int
+	data    []byte
+	ts      time.Time
+	arrival time.Time
+	seq     int
+	end     bool
+	err     error
+}
+
+// Stream stream log of all sources to w until all of them end or ctx is done.
+// error of a source is written as a line of the source, it does not stop other sources.
+func (a *Aggregator) Stream(ctx context.Context, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	lines := make(chan logLine)
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+	for i, s := range a.Sources {
+		wg.Add(1)
+		go func(i int, s Source) {
+			defer wg.Done()
+			opts := a.Options
+			opts.Container = s.Container
+			if a.Order {
+				opts.Timestamps = true
+			}
+			w := &sourceWriter{ctx: ctx, source: i, lines: lines, timestamps: opts.Timestamps}
+			err := w.wrap(a.Lines, s)
+			if err == nil {
+				err = a.Streamer.LogStreamLine(ctx, s.Pod, a.Namespace, &opts, w)
+				closeWriter(w.next)
+			}
+			select {
+			case lines <- logLine{source: i, end: true, err: err}:
+			case <-ctx.Done():
+			}
+		}(i, s)
+	}
+
+	m := &merger{a: a, w: w, lastTS: make([]time.Time, len(a.Sources)), ended: make([]bool, len(a.Sources))}
+	ticker := time.NewTicker(OrderWindow / 4)
+	defer ticker.Stop()
+	for active := len(a.Sources); active > 0; {
+		select {
+		case l := <-lines:
+			if l.end {
+				active--
+				m.ended[l.source] = true
+				if l.err != nil && ctx.Err() == nil {
+					m.write(logLine{source: l.source, data: []byte("log err: " + l.err.Error())})
+				}
+			} else if !a.Order {
+				m.write(l)
+			} else {
+				m.push(l)
+			}
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if err := m.flush(active == 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sourceWriter sends lines written by LogStreamLine to the aggregator, through SourceWriter if set.
+type sourceWriter struct {
+	ctx    context.Context
+	source int
+	lines  chan<- logLine
+	// timestamps lines are prefixed with timestamps, which are split before lines are wrapped.
+	timestamps bool
+	// next writer of lines without timestamp, ends with sourceEmitter
+	next io.Writer
+	// timestamp and arrival of the line being written
+	ts      time.Time
+	arrival time.Time
+}
+
+// wrap wrap writer of lines of source s with lines if set.
+func (w *sourceWriter) wrap(lines SourceWriter, s Source) error {
+	w.next = sourceEmitter{w}
+	if lines == nil {
+		return nil
+	}
+	next, err := lines(s, w.next)
+	if err != nil {
+		return err
+	}
+	w.next = next
+	return nil
+}
+
+// closeWriter close w if it is an io.Closer.
+func closeWriter(w io.Writer) {
+	if c, ok := w.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+func (w *sourceWriter) Write(p []byte) (int, error) {
+	// LogStreamLine writes an empty line at end of stream.
+	if len(p) == 0 {
+		return 0, nil
+	}
+	data := p
+	w.ts, w.arrival = time.Time{}, time.Now()
+	if w.timestamps {
+		if ts, rest, ok := splitTimestamp(p); ok {
+			w.ts, data = ts, rest
+		}
+	}
+	if _, err := w.next.Write(data); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// sourceEmitter sends lines to the aggregator with timestamp of the line being written.
+type sourceEmitter struct {
+	w *sourceWriter
+}
+
+func (e sourceEmitter) Write(p []byte) (int, error) {
+	l := logLine{source: e.w.source, data: append([]byte(nil), p...), ts: e.w.ts, arrival: e.w.arrival}
+	select {
+	case e.w.lines <- l:
+		return len(p), nil
+	case <-e.w.ctx.Done():
+		return 0, e.w.ctx.Err()
+	}
+}
+
+// merger writes lines with prefix, in timestamp order if enabled.
+type merger struct {
+	a       *Aggregator
+	w       io.Writer
+	pending lineHeap
+	seq     int
+	// timestamp of the last line of each source
+	lastTS []time.Time
+	ended  []bool
+	err    error
+}
+
+// push queue line l to be written in order, lines without timestamp, e.g. continuation
+// of a long line, take the timestamp of the previous line of the source.
+func (m *merger) push(l logLine) {
+	if l.ts.IsZero() {
+		l.ts = m.lastTS[l.source]
+	} else {
+		m.lastTS[l.source] = l.ts
+	}
+	m.seq++
+	l.seq = m.seq
+	heap.Push(&m.pending, l)
+}
+
+// flush write queued lines which no source could precede any more, or all if all is true.
+func (m *merger) flush(all bool) error {
+	var watermark time.Time
+	waiting := false
+	for i, ts := range m.lastTS {
+		if m.ended[i] {
+			continue
+		}
+		if !waiting || ts.Before(watermark) {
+			watermark = ts
+			waiting = true
+		}
+	}
+	deadline := time.Now().Add(-OrderWindow)
+	for m.pending.Len() > 0 && m.err == nil {
+		l := m.pending[0]
+		if !all && waiting && l.ts.After(watermark) && l.arrival.After(deadline) {
+			break
+		}
+		heap.Pop(&m.pending)
+		m.write(l)
+	}
+	return m.err
+}
+
+func (m *merger) write(l logLine) {
+	if m.err != nil {
+		return
+	}
+	var buf bytes.Buffer
+	writePrefix(&buf, m.a.Sources[l.source], l.source, m.a.Color)
+	if m.a.Options.Timestamps && !l.ts.IsZero() {
+		buf.WriteString(l.ts.Format(time.RFC3339Nano) + " ")
+	}
+	buf.Write(l.data)
+	_, m.err = m.w.Write(buf.Bytes())
+}
+
+// writePrefix write prefix of source s to buf, colored by index of s if color is true.
+func writePrefix(buf *bytes.Buffer, s Source, index int, color bool) {
+	prefix := "[" + s.String() + "] "
+	if color {
+		buf.WriteString(prefixColors[index%len(prefixColors)] + prefix + "\x1b[0m")
+	} else {
+		buf.WriteString(prefix)
+	}
+}
+
+// splitTimestamp split the RFC3339 timestamp prepended by kubelet with timestamps=true.
+func splitTimestamp(line []byte) (time.Time, []byte, bool) {
+	i := bytes.IndexByte(line, ' ')
+	if i < 0 {
+		i = len(line)
+	}
+	ts, err := time.Parse(time.RFC3339Nano, string(line[:i]))
+	if err != nil {
+		return time.Time{}, line, false
+	}
+	if i < len(line) {
+		i++
+	}
+	return ts, line[i:], true
+}
+
+// lineHeap orders lines by timestamp, then by arrival.
+type lineHeap []logLine
+
+func (h lineHeap) Len() int { return len(h) }
+func (h lineHeap) Less(i, j int) bool {
+	if !h[i].ts.Equal(h[j].ts) {
+		return h[i].ts.Before(h[j].ts)
+	}
+	return h[i].seq < h[j].seq
+}
+func (h lineHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *lineHeap) Push(x any)   { *h = append(*h, x.(logLine)) }
+func (h *lineHeap) Pop() any {
+	old := *h
+	l := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return l
+}
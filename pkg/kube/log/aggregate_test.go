@@ -0,0 +1,150 @@
+package log_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	kubeLog "github.com/maoqide/kubeutil/pkg/kube/log"
+)
+
+// fakeStreamer streams fixed lines of pods.
+type fakeStreamer map[string][]string
+
+func (f fakeStreamer) LogStreamLine(ctx context.Context, name, namespace string, opts *corev1.PodLogOptions, writer io.Writer) error {
+	lines, ok := f[name]
+	if !ok {
+		return errors.New("pod not found")
+	}
+	for _, l := range lines {
+		if !opts.Timestamps {
+			l = l[strings.IndexByte(l, ' ')+1:]
+		}
+		if _, err := writer.Write([]byte(l)); err != nil {
+			return err
+		}
+	}
+	_, err := writer.Write(nil)
+	return err
+}
+
+type lineRecorder struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (r *lineRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines = append(r.lines, string(p))
+	return len(p), nil
+}
+
+func TestAggregatorOrder(t *testing.T) {
+	streamer := fakeStreamer{
+		"web-a": {"2024-01-01T00:00:01Z one", "2024-01-01T00:00:03Z three"},
+		"web-b": {"2024-01-01T00:00:02Z two", "2024-01-01T00:00:04Z four"},
+	}
+	a := &kubeLog.Aggregator{
+		Streamer:  streamer,
+		Namespace: "default",
+		Sources:   []kubeLog.Source{{Pod: "web-a", Container: "app"}, {Pod: "web-b", Container: "app"}, {Pod: "web-c", Container: "app"}},
+		Order:     true,
+	}
+	out := &lineRecorder{}
+	if err := a.Stream(context.Background(), out); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"[web-c/app] log err: pod not found",
+		"[web-a/app] one",
+		"[web-b/app] two",
+		"[web-a/app] three",
+		"[web-b/app] four",
+	}
+	if strings.Join(out.lines, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected lines:\n%s", strings.Join(out.lines, "\n"))
+	}
+}
+
+func TestAggregatorLines(t *testing.T) {
+	streamer := fakeStreamer{
+		"web-a": {"2024-01-01T00:00:01Z one", "2024-01-01T00:00:03Z three"},
+		"web-b": {"2024-01-01T00:00:02Z two", "2024-01-01T00:00:04Z four"},
+	}
+	a := &kubeLog.Aggregator{
+		Streamer:  streamer,
+		Namespace: "default",
+		Sources:   []kubeLog.Source{{Pod: "web-a", Container: "app"}, {Pod: "web-b", Container: "app"}},
+		Order:     true,
+		Color:     true,
+		// anchored pattern matches lines without timestamp and prefix, and does not match pod names.
+		Lines: func(source kubeLog.Source, w io.Writer) (io.Writer, error) {
+			return kubeLog.NewFilter(w, kubeLog.FilterOptions{Include: []string{"^t", "web"}, Highlight: true})
+		},
+	}
+	out := &lineRecorder{}
+	if err := a.Stream(context.Background(), out); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"\x1b[33m[web-b/app] \x1b[0m\x1b[1;31mt\x1b[0mwo",
+		"\x1b[36m[web-a/app] \x1b[0m\x1b[1;31mt\x1b[0mhree",
+	}
+	if strings.Join(out.lines, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected lines:\n%q", out.lines)
+	}
+}
+
+// closeCounter counts writers closed.
+type closeCounter struct {
+	io.Writer
+	mu     *sync.Mutex
+	closed *int
+}
+
+func (c closeCounter) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*c.closed++
+	return nil
+}
+
+func TestAggregatorLinesClosed(t *testing.T) {
+	var mu sync.Mutex
+	closed := 0
+	a := &kubeLog.Aggregator{
+		Streamer:  fakeStreamer{"web-a": {"2024-01-01T00:00:01Z one"}, "web-b": {"2024-01-01T00:00:02Z two"}},
+		Namespace: "default",
+		Sources:   []kubeLog.Source{{Pod: "web-a", Container: "app"}, {Pod: "web-b", Container: "app"}, {Pod: "web-c", Container: "app"}},
+		Lines: func(source kubeLog.Source, w io.Writer) (io.Writer, error) {
+			return closeCounter{Writer: w, mu: &mu, closed: &closed}, nil
+		},
+	}
+	if err := a.Stream(context.Background(), &lineRecorder{}); err != nil {
+		t.Fatal(err)
+	}
+	// writers are closed when streams end, failed or not.
+	if closed != 3 {
+		t.Fatalf("expected 3 writers closed, got %d", closed)
+	}
+}
+
+func TestPodSources(t *testing.T) {
+	pods := []corev1.Pod{{}, {}}
+	pods[0].Name, pods[1].Name = "a", "b"
+	for i := range pods {
+		pods[i].Spec.Containers = []corev1.Container{{Name: "app"}, {Name: "sidecar"}}
+	}
+	if got := kubeLog.PodSources(pods, ""); len(got) != 4 || got[3].String() != "b/sidecar" {
+		t.Fatalf("unexpected sources %v", got)
+	}
+	if got := kubeLog.PodSources(pods, "app"); len(got) != 2 || got[1].String() != "b/app" {
+		t.Fatalf("unexpected sources %v", got)
+	}
+}
@@ -0,0 +1,281 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// log levels, in order of severity.
+var levels = []string{"trace", "debug", "info", "warn", "error", "fatal"}
+
+// levelAliases map level names of common formats to levels.
+var levelAliases = map[string]string{
+	"trace": "trace", "trc": "trace",
+	"debug": "debug", "dbug": "debug", "dbg": "debug", "d": "debug",
+	"info": "info", "inf": "info", "notice": "info", "i": "info",
+	"warn": "warn", "warning": "warn", "wrn": "warn", "w": "warn",
+	"error": "error", "eror": "error", "err": "error", "e": "error",
+	"fatal": "fatal", "crit": "fatal", "critical": "fatal", "panic": "fatal", "dpanic": "fatal", "emerg": "fatal", "alert": "fatal", "f": "fatal",
+}
+
+var (
+	// level=error, "level":"error", severity: ERROR, lvl=eror
+	keyValueLevel = regexp.MustCompile(`(?i)\b(?:level|lvl|severity)"?\s*[=:]\s*"?([a-z]+)`)
+	// [ERROR], ERROR:, WARN ...
+	bareLevel = regexp.MustCompile(`(?:^|[\s\[|])(TRACE|DEBUG|INFO|NOTICE|WARN|WARNING|ERROR|ERR|FATAL|CRIT|CRITICAL|PANIC)(?:$|[\s\]|:])`)
+	// klog, e.g. E0102 15:04:05.000000
+	klogLevel = regexp.MustCompile(`(?:^|\s)([IWEF])\d{4} \d{2}:\d{2}:\d{2}`)
+)
+
+const (
+	highlightStart = "\x1b[1;31m"
+	highlightEnd   = "\x1b[0m"
+	// contextSeparator is written between non-adjacent groups of lines with context, like grep.
+	contextSeparator = "--"
+)
+
+// FilterOptions select lines of a log stream.
+type FilterOptions struct {
+	// Include regexps, a line must match any of them if not empty.
+	Include []string `json:"include,omitempty"`
+	// Exclude regexps, a line must match none of them.
+	Exclude    []string `json:"exclude,omitempty"`
+	IgnoreCase bool     `json:"ignoreCase,omitempty"`
+	// Before and After number of context lines around selected lines.
+	Before int `json:"before,omitempty"`
+	After  int `json:"after,omitempty"`
+	// Highlight highlight matches of Include with ansi colors.
+	Highlight bool `json:"highlight,omitempty"`
+	// Level minimum level of selected lines, one of trace, debug, info, warn, error and fatal.
+	// lines without a recognized level take the level of the previous line, e.g. stack traces.
+	Level string `json:"level,omitempty"`
+}
+
+// ParseFilterOptions parse filter options from query params grep and exclude (both could be repeated), ignoreCase,
+// before, after, context (both before and after), highlight and level. nil if no filter is set.
+func ParseFilterOptions(query url.Values) (*FilterOptions, error) {
+	o := &FilterOptions{
+		Include: query["grep"],
+		Exclude: query["exclude"],
+		Level:   strings.ToLower(query.Get("level")),
+	}
+	var errs []error
+	parseBool := func(key string, v *bool) {
+		if s := query.Get(key); s != "" {
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s '%s', expect true or false", key, s))
+			}
+			*v = b
+		}
+	}
+	parseInt := func(key string, v *int) {
+		if s := query.Get(key); s != "" {
+			i, err := strconv.Atoi(s)
+			if err != nil || i < 0 {
+				errs = append(errs, fmt.Errorf("invalid %s '%s', expect integer >= 0", key, s))
+			}
+			*v = i
+		}
+	}
+	parseBool("ignoreCase", &o.IgnoreCase)
+	parseBool("highlight", &o.Highlight)
+	var context int
+	parseInt("context", &context)
+	o.Before, o.After = context, context
+	parseInt("before", &o.Before)
+	parseInt("after", &o.After)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if len(o.Include) == 0 && len(o.Exclude) == 0 && o.Level == "" {
+		return nil, nil
+	}
+	// validate patterns and level.
+	if _, err := NewFilter(io.Discard, *o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Filter writes selected lines of a log stream written to it line by line, with context lines.
+// It is not safe for concurrent use.
+type Filter struct {
+	w       io.Writer
+	opts    FilterOptions
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+	// minimum level index, -1 to select all
+	level int
+	// level of the last line with recognized level
+	lastLevel int
+	// lines held as context before the next selected line
+	before [][]byte
+	// remaining lines to write after the last selected line
+	after int
+	// whether a line was skipped since the last written line
+	skipped bool
+	written bool
+}
+
+// NewFilter create Filter writing lines selected by opts to w.
+func NewFilter(w io.Writer, opts FilterOptions) (*Filter, error) {
+	f := &Filter{w: w, opts: opts, level: -1, lastLevel: -1}
+	compile := func(exprs []string) ([]*regexp.Regexp, error) {
+		var res []*regexp.Regexp
+		for _, expr := range exprs {
+			if opts.IgnoreCase {
+				expr = "(?i)" + expr
+			}
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern '%s': %v", expr, err)
+			}
+			res = append(res, re)
+		}
+		return res, nil
+	}
+	var err error
+	if f.include, err = compile(opts.Include); err != nil {
+		return nil, err
+	}
+	if f.exclude, err = compile(opts.Exclude); err != nil {
+		return nil, err
+	}
+	if opts.Level != "" {
+		if f.level = levelIndex(opts.Level); f.level < 0 {
+			return nil, fmt.Errorf("unknown level '%s', expect one of %s", opts.Level, strings.Join(levels, ", "))
+		}
+	}
+	return f, nil
+}
+
+// Write write line p if it is selected or in context of a selected line.
+// p must be a whole line, e.g. written by CopyLines.
+func (f *Filter) Write(p []byte) (int, error) {
+	if f.selected(p) {
+		if f.skipped && f.written && (f.opts.Before > 0 || f.opts.After > 0) {
+			if err := f.write([]byte(contextSeparator)); err != nil {
+				return 0, err
+			}
+		}
+		for _, l := range f.before {
+			if err := f.write(l); err != nil {
+				return 0, err
+			}
+		}
+		f.before = f.before[:0]
+		f.after = f.opts.After
+		f.skipped = false
+		if err := f.write(f.highlight(p)); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if f.after > 0 {
+		f.after--
+		if err := f.write(p); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if f.opts.Before > 0 {
+		if len(f.before) == f.opts.Before {
+			f.skipped = true
+			f.before = f.before[1:]
+		}
+		f.before = append(f.before, append([]byte(nil), p...))
+		return len(p), nil
+	}
+	f.skipped = true
+	return len(p), nil
+}
+
+func (f *Filter) write(p []byte) error {
+	f.written = true
+	_, err := f.w.Write(p)
+	return err
+}
+
+// selected return whether line p is selected by level, include and exclude.
+func (f *Filter) selected(p []byte) bool {
+	if f.level >= 0 {
+		if l := detectLevel(p); l >= 0 {
+			f.lastLevel = l
+		}
+		if f.lastLevel >= 0 && f.lastLevel < f.level {
+			return false
+		}
+	}
+	for _, re := range f.exclude {
+		if re.Match(p) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, re := range f.include {
+		if re.Match(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// highlight wrap matches of include patterns in p with ansi colors.
+func (f *Filter) highlight(p []byte) []byte {
+	if !f.opts.Highlight || len(f.include) == 0 {
+		return p
+	}
+	marked := make([]bool, len(p))
+	for _, re := range f.include {
+		for _, m := range re.FindAllIndex(p, -1) {
+			for i := m[0]; i < m[1]; i++ {
+				marked[i] = true
+			}
+		}
+	}
+	var buf bytes.Buffer
+	for i := 0; i < len(p); i++ {
+		if marked[i] && (i == 0 || !marked[i-1]) {
+			buf.WriteString(highlightStart)
+		}
+		buf.WriteByte(p[i])
+		if marked[i] && (i == len(p)-1 || !marked[i+1]) {
+			buf.WriteString(highlightEnd)
+		}
+	}
+	return buf.Bytes()
+}
+
+// detectLevel return level index of line p, -1 if not recognized.
+func detectLevel(p []byte) int {
+	for _, re := range []*regexp.Regexp{keyValueLevel, klogLevel, bareLevel} {
+		if m := re.FindSubmatch(p); m != nil {
+			if l := levelIndex(string(m[1])); l >= 0 {
+				return l
+			}
+		}
+	}
+	return -1
+}
+
+func levelIndex(name string) int {
+	level, ok := levelAliases[strings.ToLower(name)]
+	if !ok {
+		return -1
+	}
+	for i, l := range levels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,97 @@
+package log_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	kubeLog "github.com/maoqide/kubeutil/pkg/kube/log"
+)
+
+func filterLines(t *testing.T, opts kubeLog.FilterOptions, lines ...string) []string {
+	t.Helper()
+	out := &lineRecorder{}
+	f, err := kubeLog.NewFilter(out, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range lines {
+		if _, err := f.Write([]byte(l)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return out.lines
+}
+
+func TestFilterGrep(t *testing.T) {
+	lines := []string{"start", "a", "b", "GET /health", "c", "d", "e", "GET /api", "f"}
+	got := filterLines(t, kubeLog.FilterOptions{Include: []string{"get /"}, Exclude: []string{"health"}, IgnoreCase: true}, lines...)
+	if strings.Join(got, ",") != "GET /api" {
+		t.Fatalf("unexpected lines %q", got)
+	}
+	got = filterLines(t, kubeLog.FilterOptions{Include: []string{"GET"}, Before: 1, After: 1}, lines...)
+	if want := "b,GET /health,c,--,e,GET /api,f"; strings.Join(got, ",") != want {
+		t.Fatalf("unexpected lines %q, want %q", got, want)
+	}
+	got = filterLines(t, kubeLog.FilterOptions{Include: []string{"api"}, Highlight: true}, lines...)
+	if len(got) != 1 || got[0] != "GET /\x1b[1;31mapi\x1b[0m" {
+		t.Fatalf("unexpected highlight %q", got)
+	}
+}
+
+func TestFilterLevel(t *testing.T) {
+	lines := []string{
+		`level=info msg="started"`,
+		`{"level":"error","msg":"failed"}`,
+		`  at main.go:10`,
+		`2024-01-01 12:00:00 [DEBUG] connecting`,
+		`W0102 15:04:05.000000 1 main.go:20] slow`,
+		`plain line`,
+	}
+	got := filterLines(t, kubeLog.FilterOptions{Level: "warn"}, lines...)
+	want := []string{lines[1], lines[2], lines[4], lines[5]}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected lines:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestFilterLongLine(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	text := "before " + long + "\n" + `{"msg":"` + long + `","level":"error","path":"GET /api"}` + "\nafter\n"
+	out := &lineRecorder{}
+	f, err := kubeLog.NewFilter(out, kubeLog.FilterOptions{Include: []string{"GET /api"}, Before: 1, Level: "error", Highlight: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// lines longer than 256 bytes are matched and counted as a whole.
+	if err := kubeLog.CopyLines(strings.NewReader(text), f); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"before " + long,
+		`{"msg":"` + long + `","level":"error","path":"` + "\x1b[1;31mGET /api\x1b[0m" + `"}`,
+	}
+	if strings.Join(out.lines, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected lines %q", out.lines)
+	}
+}
+
+func TestParseFilterOptions(t *testing.T) {
+	query, _ := url.ParseQuery("grep=error&grep=panic&context=2&after=5&level=WARN")
+	o, err := kubeLog.ParseFilterOptions(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(o.Include) != 2 || o.Before != 2 || o.After != 5 || o.Level != "warn" {
+		t.Fatalf("unexpected options %+v", o)
+	}
+	if o, err := kubeLog.ParseFilterOptions(url.Values{}); o != nil || err != nil {
+		t.Fatalf("expect no filter, got %+v, %v", o, err)
+	}
+	for _, raw := range []string{"grep=(", "level=verbose", "context=-1"} {
+		query, _ := url.ParseQuery(raw)
+		if _, err := kubeLog.ParseFilterOptions(query); err == nil {
+			t.Errorf("parse %s: expect error", raw)
+		}
+	}
+}
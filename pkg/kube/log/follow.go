@@ -0,0 +1,534 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const (
+	// followRetry is the initial delay to reattach to a container after its log stream ended,
+	// doubled up to followMaxRetry while the stream ends without any line.
+	followRetry    = time.Second
+	followMaxRetry = 30 * time.Second
+
+	// followWatchTimeout pods are listed again when watch times out, to catch up missed events.
+	followWatchTimeout = int64(300)
+)
+
+var (
+	// revisionLabels are labels set per revision by controllers, not shared by replacement pods.
+	revisionLabels = []string{"pod-template-hash", "controller-revision-hash", "pod-template-generation"}
+	// identityLabels are labels set per pod by statefulset controller.
+	identityLabels = []string{"statefulset.kubernetes.io/pod-name", "apps.kubernetes.io/pod-index"}
+)
+
+// ReplacementSelector return label selector of pods which could replace pod, e.g. in a rollout.
+// a statefulset pod is only replaced by the pod of the same identity, not by another replica.
+// it is empty if pod is not a replica of a workload, which is never replaced.
+func ReplacementSelector(pod *corev1.Pod) string {
+	if len(pod.OwnerReferences) == 0 {
+		return ""
+	}
+	set := labels.Set{}
+	for k, v := range pod.Labels {
+		set[k] = v
+	}
+	for _, k := range revisionLabels {
+		delete(set, k)
+	}
+	if !ownedBy(pod, "StatefulSet") {
+		for _, k := range identityLabels {
+			delete(set, k)
+		}
+	}
+	if len(set) == 0 {
+		return ""
+	}
+	return labels.SelectorFromSet(set).String()
+}
+
+func ownedBy(pod *corev1.Pod, kind string) bool {
+	for _, ref := range pod.OwnerReferences {
+		if ref.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// PodWatcher lists and watches pods, implemented by kube.PodBox.
+type PodWatcher interface {
+	ListWithOptions(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.PodList, error)
+	WatchWithOptions(ctx context.Context, namespace string, opts metav1.ListOptions) (watch.Interface, error)
+}
+
+// Follower follows log of pods matching a selector across container restarts and pod replacement, e.g. rollouts.
+// It attaches to new pods and restarted containers as they start running, marks gaps in the stream,
+// and skips lines already written by SinceTime when it reattaches to the same container.
+type Follower struct {
+	Streamer  LogStreamer
+	Pods      PodWatcher
+	Namespace string
+	// Selector label selector of pods to follow.
+	Selector string
+	// Pod follow only this pod if set, once it is gone, switch to the newest running pod matching Selector.
+	// Pod is never switched if Selector is empty, only Pod is listed and watched then.
+	Pod string
+	// Container to follow, all containers if empty.
+	Container string
+	// Options of the first attach to each container, Follow and Timestamps are always enabled to resume,
+	// timestamps are written only if Options.Timestamps is true.
+	Options corev1.PodLogOptions
+	// Prefix prefix lines with pod/container, colored if Color is true.
+	Prefix bool
+	Color  bool
+	// Lines wraps writer of lines of each attach to a container if set, gap markers are not written through it.
+	// the attach fails and is retried if it returns error.
+	Lines SourceWriter
+}
+
+// followStream is the state of following a container.
+type followStream struct {
+	source Source
+	index  int
+	active bool
+	// retry of the ended stream is scheduled
+	retrying    bool
+	attached    bool
+	containerID string
+	lastTS      time.Time
+	backoff     time.Duration
+}
+
+// streamEnd reports a log stream of a container ended.
+type streamEnd struct {
+	key    string
+	lastTS time.Time
+	lines  int
+	err    error
+}
+
+// follow is the state of Follower.Follow, owned by the event loop.
+type follow struct {
+	f       *Follower
+	ctx     context.Context
+	out     *syncWriter
+	streams map[string]*followStream
+	pods    map[string]*corev1.Pod
+	// pod followed if Follower.Pod is set
+	current string
+	ended   chan streamEnd
+	retry   chan string
+	wg      sync.WaitGroup
+}
+
+// Follow follow logs and write them to w until ctx is done or writing failed.
+func (f *Follower) Follow(ctx context.Context, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &follow{
+		f:       f,
+		ctx:     ctx,
+		out:     &syncWriter{w: w},
+		streams: map[string]*followStream{},
+		pods:    map[string]*corev1.Pod{},
+		current: f.Pod,
+		ended:   make(chan streamEnd),
+		retry:   make(chan string),
+	}
+	defer func() {
+		cancel()
+		s.wg.Wait()
+	}()
+	for {
+		if err := s.list(); err != nil {
+			s.mark(Source{}, fmt.Sprintf("list pods err: %v, retrying...", err))
+			if err := s.wait(followMaxRetry); err != nil {
+				return err
+			}
+			continue
+		}
+		opts := f.listOptions()
+		timeout := followWatchTimeout
+		opts.TimeoutSeconds = &timeout
+		watcher, err := f.Pods.WatchWithOptions(ctx, f.Namespace, opts)
+		if err != nil {
+			s.mark(Source{}, fmt.Sprintf("watch pods err: %v, retrying...", err))
+			if err := s.wait(followMaxRetry); err != nil {
+				return err
+			}
+			continue
+		}
+		err = s.watch(watcher)
+		watcher.Stop()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// listOptions return options to list and watch pods to follow.
+func (f *Follower) listOptions() metav1.ListOptions {
+	if f.Selector == "" && f.Pod != "" {
+		return metav1.ListOptions{FieldSelector: fields.OneTermEqualSelector("metadata.name", f.Pod).String()}
+	}
+	return metav1.ListOptions{LabelSelector: f.Selector}
+}
+
+// watch handle events until watcher ends, error only if following should stop.
+func (s *follow) watch(watcher watch.Interface) error {
+	for {
+		select {
+		case event, ok := <-watcher.ResultChan():
+			if !ok || event.Type == watch.Error {
+				return s.out.Err()
+			}
+			pod, ok := event.Object.(*corev1.Pod)
+			if !ok {
+				continue
+			}
+			if event.Type == watch.Deleted {
+				s.deleted(pod.Name)
+			} else {
+				s.update(pod)
+			}
+		case end := <-s.ended:
+			s.streamEnded(end)
+		case key := <-s.retry:
+			s.retried(key)
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		}
+		if err := s.out.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// wait wait d while handling stream events.
+func (s *follow) wait(d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	for {
+		select {
+		case end := <-s.ended:
+			s.streamEnded(end)
+		case key := <-s.retry:
+			s.retried(key)
+		case <-timer.C:
+			return s.out.Err()
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		}
+	}
+}
+
+// list reconcile all pods, pods gone since the last list are handled as deleted.
+func (s *follow) list() error {
+	pods, err := s.f.Pods.ListWithOptions(s.ctx, s.f.Namespace, s.f.listOptions())
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for i := range pods.Items {
+		seen[pods.Items[i].Name] = true
+	}
+	for name := range s.pods {
+		if !seen[name] {
+			s.deleted(name)
+		}
+	}
+	for i := range pods.Items {
+		s.update(&pods.Items[i])
+	}
+	if _, ok := s.pods[s.current]; s.current != "" && !ok {
+		s.mark(Source{}, "pod "+s.current+" not found")
+		s.current = ""
+		s.pick()
+	}
+	return nil
+}
+
+// update attach to running containers of pod not followed yet.
+func (s *follow) update(pod *corev1.Pod) {
+	s.pods[pod.Name] = pod
+	if s.f.Pod != "" {
+		if s.current == "" {
+			s.pick()
+		}
+		if pod.Name != s.current {
+			return
+		}
+	}
+	if pod.DeletionTimestamp != nil {
+		// streams end once containers are stopped.
+		return
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if s.f.Container != "" && cs.Name != s.f.Container {
+			continue
+		}
+		if cs.State.Running == nil {
+			continue
+		}
+		key := pod.Name + "/" + cs.Name
+		st, ok := s.streams[key]
+		if !ok {
+			st = &followStream{source: Source{Pod: pod.Name, Container: cs.Name}, index: len(s.streams), backoff: followRetry}
+			s.streams[key] = st
+		}
+		if st.active || (st.retrying && st.containerID == cs.ContainerID) {
+			continue
+		}
+		s.start(key, st, cs.ContainerID)
+	}
+}
+
+// deleted handle pod gone, switch to another pod if it is the followed one.
+func (s *follow) deleted(name string) {
+	if _, ok := s.pods[name]; !ok {
+		return
+	}
+	delete(s.pods, name)
+	for key, st := range s.streams {
+		if st.source.Pod == name && !st.active {
+			delete(s.streams, key)
+		}
+	}
+	if s.f.Pod == "" || name == s.current {
+		s.mark(Source{}, "pod "+name+" deleted")
+	}
+	if s.f.Pod != "" && name == s.current {
+		s.current = ""
+		s.pick()
+	}
+}
+
+// pick pick the newest running pod to follow in place of the followed one.
+func (s *follow) pick() {
+	if s.f.Selector == "" {
+		return
+	}
+	var candidates []*corev1.Pod
+	for _, pod := range s.pods {
+		if pod.DeletionTimestamp == nil && pod.Status.Phase == corev1.PodRunning {
+			candidates = append(candidates, pod)
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].CreationTimestamp.After(candidates[j].CreationTimestamp.Time)
+	})
+	s.current = candidates[0].Name
+	s.mark(Source{}, "following pod "+s.current)
+	s.update(candidates[0])
+}
+
+// start start streaming container with containerID, resuming from where it stopped if it is the same container.
+func (s *follow) start(key string, st *followStream, containerID string) {
+	opts := s.f.Options
+	opts.Container = st.source.Container
+	opts.Follow = true
+	opts.Timestamps = true
+	var since time.Time
+	if st.attached {
+		opts.TailLines, opts.SinceSeconds, opts.SinceTime, opts.LimitBytes = nil, nil, nil, nil
+		if containerID == st.containerID && !st.lastTS.IsZero() {
+			since = st.lastTS
+			opts.SinceTime = &metav1.Time{Time: since}
+			s.mark(st.source, "reattached")
+		} else {
+			s.mark(st.source, "container restarted")
+		}
+	}
+	st.attached, st.active, st.retrying, st.containerID = true, true, false, containerID
+	w := &followWriter{s: s, st: *st, since: since}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		err := w.wrap(s.f.Lines)
+		if err == nil {
+			err = s.f.Streamer.LogStreamLine(s.ctx, st.source.Pod, s.f.Namespace, &opts, w)
+			closeWriter(w.next)
+		}
+		select {
+		case s.ended <- streamEnd{key: key, lastTS: w.lastTS, lines: w.lines, err: err}:
+		case <-s.ctx.Done():
+		}
+	}()
+}
+
+// streamEnded mark the gap and schedule reattach to the container.
+func (s *follow) streamEnded(end streamEnd) {
+	st, ok := s.streams[end.key]
+	if !ok {
+		return
+	}
+	st.active = false
+	if !end.lastTS.IsZero() {
+		st.lastTS = end.lastTS
+	}
+	reason := "log stream ended"
+	if end.err != nil {
+		reason += ": " + end.err.Error()
+	}
+	s.mark(st.source, reason)
+	if _, ok := s.pods[st.source.Pod]; !ok {
+		delete(s.streams, end.key)
+		return
+	}
+	if end.lines > 0 {
+		st.backoff = followRetry
+	} else if st.backoff *= 2; st.backoff > followMaxRetry {
+		st.backoff = followMaxRetry
+	}
+	st.retrying = true
+	time.AfterFunc(st.backoff, func() {
+		select {
+		case s.retry <- end.key:
+		case <-s.ctx.Done():
+		}
+	})
+}
+
+// retried reattach to container if it is still running.
+func (s *follow) retried(key string) {
+	st, ok := s.streams[key]
+	if !ok || !st.retrying {
+		return
+	}
+	st.retrying = false
+	if pod, ok := s.pods[st.source.Pod]; ok {
+		s.update(pod)
+	}
+}
+
+// mark write a gap marker of source, or of the follower if source is empty.
+func (s *follow) mark(source Source, msg string) {
+	var buf bytes.Buffer
+	if source.Container != "" {
+		if s.f.Prefix {
+			writePrefix(&buf, source, s.index(source), s.f.Color)
+		} else {
+			msg = source.String() + ": " + msg
+		}
+	}
+	buf.WriteString("--- " + msg + " ---")
+	s.out.Write(buf.Bytes())
+}
+
+func (s *follow) index(source Source) int {
+	if st, ok := s.streams[source.String()]; ok {
+		return st.index
+	}
+	return 0
+}
+
+// followWriter writes lines of a container stream, skipping lines not after since.
+type followWriter struct {
+	s      *follow
+	st     followStream
+	since  time.Time
+	lastTS time.Time
+	lines  int
+	// the last line with timestamp was written already, skip the rest of it
+	skipping bool
+	// next writer of lines without timestamp, ends with followEmitter
+	next io.Writer
+	// timestamp of the line being written, zero if it has none
+	ts time.Time
+}
+
+// wrap wrap writer of lines with lines if set.
+func (w *followWriter) wrap(lines SourceWriter) error {
+	w.next = followEmitter{w}
+	if lines == nil {
+		return nil
+	}
+	next, err := lines(w.st.source, w.next)
+	if err != nil {
+		return err
+	}
+	w.next = next
+	return nil
+}
+
+func (w *followWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	ts, data, ok := splitTimestamp(p)
+	if ok {
+		w.skipping = !ts.After(w.since)
+		if !w.skipping {
+			w.lastTS = ts
+		}
+	}
+	if w.skipping {
+		// parts of a long line after the first have no timestamp, they go with it.
+		return len(p), nil
+	}
+	w.lines++
+	w.ts = ts
+	if _, err := w.next.Write(data); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// followEmitter writes lines with prefix and timestamp of the line being written.
+type followEmitter struct {
+	w *followWriter
+}
+
+func (e followEmitter) Write(p []byte) (int, error) {
+	var buf bytes.Buffer
+	if e.w.s.f.Prefix {
+		writePrefix(&buf, e.w.st.source, e.w.st.index, e.w.s.f.Color)
+	}
+	if !e.w.ts.IsZero() && e.w.s.f.Options.Timestamps {
+		buf.WriteString(e.w.ts.Format(time.RFC3339Nano) + " ")
+	}
+	buf.Write(p)
+	if _, err := e.w.s.out.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// syncWriter serializes writes, and keeps the first error.
+type syncWriter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	err error
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.w.Write(p)
+	w.err = err
+	return n, err
+}
+
+// Err return the first write error.
+func (w *syncWriter) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
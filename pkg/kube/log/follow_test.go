@@ -0,0 +1,289 @@
+package log_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+
+	kubeLog "github.com/maoqide/kubeutil/pkg/kube/log"
+)
+
+// fakePods lists pods and hands out a fake watcher.
+type fakePods struct {
+	pods    []corev1.Pod
+	watcher *watch.FakeWatcher
+	// field selectors listed with
+	fieldSelectors []string
+}
+
+func (f *fakePods) ListWithOptions(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.PodList, error) {
+	selector, err := labels.Parse(opts.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+	f.fieldSelectors = append(f.fieldSelectors, opts.FieldSelector)
+	fieldSelector, err := fields.ParseSelector(opts.FieldSelector)
+	if err != nil {
+		return nil, err
+	}
+	list := &corev1.PodList{}
+	for _, pod := range f.pods {
+		if selector.Matches(labels.Set(pod.Labels)) && fieldSelector.Matches(fields.Set{"metadata.name": pod.Name}) {
+			list.Items = append(list.Items, pod)
+		}
+	}
+	return list, nil
+}
+
+func (f *fakePods) WatchWithOptions(ctx context.Context, namespace string, opts metav1.ListOptions) (watch.Interface, error) {
+	return f.watcher, nil
+}
+
+// scriptedStreamer streams lines of each call to a pod in order, then blocks if follow is the last call.
+type scriptedStreamer struct {
+	mu    sync.Mutex
+	calls map[string][][]string
+	since []string
+}
+
+func (s *scriptedStreamer) LogStreamLine(ctx context.Context, name, namespace string, opts *corev1.PodLogOptions, writer io.Writer) error {
+	s.mu.Lock()
+	if opts.SinceTime != nil {
+		s.since = append(s.since, opts.SinceTime.UTC().Format(time.RFC3339))
+	}
+	calls := s.calls[name]
+	if len(calls) == 0 {
+		s.mu.Unlock()
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	lines := calls[0]
+	s.calls[name] = calls[1:]
+	s.mu.Unlock()
+	for _, l := range lines {
+		if _, err := writer.Write([]byte(l)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runningPod(name, containerID string, created time.Time) *corev1.Pod {
+	pod := &corev1.Pod{}
+	pod.Name = name
+	pod.Labels = map[string]string{"app": "web"}
+	pod.CreationTimestamp = metav1.NewTime(created)
+	pod.Status.Phase = corev1.PodRunning
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name:        "app",
+		ContainerID: containerID,
+		State:       corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+	}}
+	return pod
+}
+
+// waitLines wait until out has n lines.
+func waitLines(t *testing.T, out *lineRecorder, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		out.mu.Lock()
+		lines := append([]string(nil), out.lines...)
+		out.mu.Unlock()
+		if len(lines) >= n {
+			return lines
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timeout waiting for %d lines, got:\n%s", n, strings.Join(out.lines, "\n"))
+	return nil
+}
+
+func TestFollowerReattach(t *testing.T) {
+	now := time.Now()
+	pods := &fakePods{pods: []corev1.Pod{*runningPod("web-1", "c1", now)}, watcher: watch.NewFake()}
+	streamer := &scriptedStreamer{calls: map[string][][]string{
+		"web-1": {
+			// a long line goes on in parts without timestamp.
+			{"2024-01-01T00:00:01Z one", "2024-01-01T00:00:02Z two", "continued"},
+			// reattached by SinceTime, repeats the last line.
+			{"2024-01-01T00:00:02Z two", "continued", "2024-01-01T00:00:03Z three"},
+		},
+		"web-2": {
+			{"2024-01-01T00:01:00Z new pod"},
+		},
+	}}
+	f := &kubeLog.Follower{
+		Streamer:  streamer,
+		Pods:      pods,
+		Namespace: "default",
+		Selector:  "app=web",
+		Pod:       "web-1",
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := &lineRecorder{}
+	done := make(chan error)
+	go func() {
+		done <- f.Follow(ctx, out)
+	}()
+
+	waitLines(t, out, 7)
+	// rollout replaces the pod.
+	pods.watcher.Add(runningPod("web-2", "c2", now.Add(time.Minute)))
+	pods.watcher.Delete(runningPod("web-1", "c1", now))
+	lines := waitLines(t, out, 11)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{
+		"one",
+		"two",
+		"continued",
+		"--- web-1/app: log stream ended ---",
+		"--- web-1/app: reattached ---",
+		"three",
+		"--- web-1/app: log stream ended ---",
+		"--- pod web-1 deleted ---",
+		"--- following pod web-2 ---",
+		"new pod",
+		"--- web-2/app: log stream ended ---",
+	}
+	if strings.Join(lines[:len(want)], "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected lines:\n%s", strings.Join(lines, "\n"))
+	}
+	if len(streamer.since) == 0 || streamer.since[0] != "2024-01-01T00:00:02Z" {
+		t.Fatalf("unexpected since %v", streamer.since)
+	}
+}
+
+// statefulSetPod is a running replica of statefulset repl.
+func statefulSetPod(name, containerID string, created time.Time) *corev1.Pod {
+	pod := runningPod(name, containerID, created)
+	pod.Labels = map[string]string{
+		"app":                                "repl",
+		"controller-revision-hash":           "repl-5d4f",
+		"statefulset.kubernetes.io/pod-name": name,
+	}
+	pod.OwnerReferences = []metav1.OwnerReference{{Kind: "StatefulSet", Name: "repl"}}
+	return pod
+}
+
+func TestReplacementSelector(t *testing.T) {
+	deployment := runningPod("web-1", "c1", time.Now())
+	deployment.Labels["pod-template-hash"] = "7c9d"
+	if got := kubeLog.ReplacementSelector(deployment); got != "" {
+		t.Errorf("unexpected selector of pod without owner: %s", got)
+	}
+	deployment.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web-7c9d"}}
+	if got := kubeLog.ReplacementSelector(deployment); got != "app=web" {
+		t.Errorf("unexpected selector of deployment pod: %s", got)
+	}
+	sts := statefulSetPod("repl-0", "c1", time.Now())
+	if got := kubeLog.ReplacementSelector(sts); got != "app=repl,statefulset.kubernetes.io/pod-name=repl-0" {
+		t.Errorf("unexpected selector of statefulset pod: %s", got)
+	}
+}
+
+func TestFollowerStatefulSetPod(t *testing.T) {
+	now := time.Now()
+	repl0 := statefulSetPod("repl-0", "c1", now)
+	pods := &fakePods{
+		pods:    []corev1.Pod{*repl0, *statefulSetPod("repl-2", "c2", now.Add(time.Minute))},
+		watcher: watch.NewFake(),
+	}
+	streamer := &scriptedStreamer{calls: map[string][][]string{
+		"repl-0": {
+			{"2024-01-01T00:00:01Z zero"},
+			{"2024-01-01T00:02:00Z recreated"},
+		},
+		"repl-2": {
+			{"2024-01-01T00:01:00Z other replica"},
+		},
+	}}
+	f := &kubeLog.Follower{
+		Streamer:  streamer,
+		Pods:      pods,
+		Namespace: "default",
+		Selector:  kubeLog.ReplacementSelector(repl0),
+		Pod:       "repl-0",
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := &lineRecorder{}
+	done := make(chan error)
+	go func() {
+		done <- f.Follow(ctx, out)
+	}()
+
+	waitLines(t, out, 2)
+	// the followed replica is deleted, the other one must not be followed in place of it.
+	pods.watcher.Delete(repl0)
+	pods.watcher.Add(statefulSetPod("repl-0", "c3", now.Add(2*time.Minute)))
+	lines := waitLines(t, out, 6)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{
+		"zero",
+		"--- repl-0/app: log stream ended ---",
+		"--- pod repl-0 deleted ---",
+		"--- following pod repl-0 ---",
+		"recreated",
+		"--- repl-0/app: log stream ended ---",
+	}
+	if strings.Join(lines[:len(want)], "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected lines:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestFollowerSinglePod(t *testing.T) {
+	now := time.Now()
+	pods := &fakePods{
+		pods:    []corev1.Pod{*runningPod("web-1", "c1", now), *runningPod("web-2", "c2", now)},
+		watcher: watch.NewFake(),
+	}
+	streamer := &scriptedStreamer{calls: map[string][][]string{
+		"web-1": {{"2024-01-01T00:00:01Z one"}},
+		"web-2": {{"2024-01-01T00:00:02Z other pod"}},
+	}}
+	// pod without owner is followed by name only, not by its labels.
+	f := &kubeLog.Follower{
+		Streamer:  streamer,
+		Pods:      pods,
+		Namespace: "default",
+		Selector:  kubeLog.ReplacementSelector(runningPod("web-1", "c1", now)),
+		Pod:       "web-1",
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := &lineRecorder{}
+	done := make(chan error)
+	go func() {
+		done <- f.Follow(ctx, out)
+	}()
+	lines := waitLines(t, out, 2)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lines[0] != "one" {
+		t.Fatalf("unexpected lines:\n%s", strings.Join(lines, "\n"))
+	}
+	if len(pods.fieldSelectors) == 0 || pods.fieldSelectors[0] != "metadata.name=web-1" {
+		t.Fatalf("unexpected field selectors %v", pods.fieldSelectors)
+	}
+}
@@ -0,0 +1,35 @@
+package log
+
+import (
+	"bufio"
+	"io"
+
+	"github.com/maoqide/kubeutil/utils"
+)
+
+// MaxLineSize log lines longer than this are written in parts.
+const MaxLineSize = 1 << 20
+
+// CopyLines copy log from r to w one line per write, without line break, so that writers
+// redact and filter whole lines. an empty line is written at the end of r.
+func CopyLines(r io.Reader, w io.Writer) error {
+	reader := bufio.NewReaderSize(r, 4096)
+	var line []byte
+	for {
+		fragment, isPrefix, err := reader.ReadLine()
+		if err != nil {
+			if err == io.EOF {
+				_, err = w.Write(line)
+			}
+			return err
+		}
+		line = append(line, fragment...)
+		if isPrefix && len(line) < MaxLineSize {
+			continue
+		}
+		if _, err := w.Write(utils.ToValidUTF8(line, []byte(""))); err != nil {
+			return err
+		}
+		line = line[:0]
+	}
+}
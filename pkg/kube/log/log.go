@@ -1,12 +1,70 @@
 package log
 
 import (
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
+	"sync"
 
 	"github.com/gorilla/websocket"
 )
 
+// Protocol is the websocket subprotocol of typed frames. Every server message is a json encoded Frame,
+// every client message is a json encoded Control. Without it log lines are sent as plain text frames.
+const Protocol = "logs.kubeutil.io"
+
+// frame types
+const (
+	// FrameLine a log line
+	FrameLine = "line"
+	// FrameStatus status of the stream, e.g. paused or reattached
+	FrameStatus = "status"
+	// FrameError error of the stream
+	FrameError = "error"
+	// FrameSnapshot log snapshot requested by client, Name is the suggested file name
+	FrameSnapshot = "snapshot"
+)
+
+// control operations
+const (
+	// ControlPause hold lines until resume
+	ControlPause = "pause"
+	// ControlResume send held lines and go on
+	ControlResume = "resume"
+	// ControlFilter change line filter of the stream, Filter nil to disable
+	ControlFilter = "filter"
+	// ControlRestream restart the stream with Options, e.g. another tail or since
+	ControlRestream = "restream"
+	// ControlContainer restart the stream of Container
+	ControlContainer = "container"
+	// ControlSnapshot request current log as a snapshot frame
+	ControlSnapshot = "snapshot"
+)
+
+const (
+	// maxPausedLines lines held while paused, older ones are dropped.
+	maxPausedLines = 10000
+
+	// Maximum message size allowed from peer.
+	maxControlSize = 8192
+)
+
+// Frame is a server message of Protocol.
+type Frame struct {
+	Type string `json:"type"`
+	Data string `json:"data"`
+	Name string `json:"name,omitempty"`
+}
+
+// Control is a client message of Protocol.
+type Control struct {
+	Operation string         `json:"operation"`
+	Filter    *FilterOptions `json:"filter,omitempty"`
+	Options   *Options       `json:"options,omitempty"`
+	Container string         `json:"container,omitempty"`
+}
+
 // Logger is interface for output pod log
 type Logger interface {
 	io.WriteCloser
@@ -14,6 +72,7 @@ type Logger interface {
 
 var upgrader = func() websocket.Upgrader {
 	upgrader := websocket.Upgrader{}
+	upgrader.Subprotocols = []string{Protocol}
 	upgrader.CheckOrigin = func(r *http.Request) bool {
 		return true
 	}
@@ -23,6 +82,17 @@ var upgrader = func() websocket.Upgrader {
 // WsLogger output container log to websocket
 type WsLogger struct {
 	wsConn *websocket.Conn
+	typed  bool
+
+	controls chan Control
+	// closed when reading from client failed, e.g. client closed
+	done chan struct{}
+
+	// serialize writes, guards paused, held and dropped
+	mu      sync.Mutex
+	paused  bool
+	held    [][]byte
+	dropped int
 }
 
 // NewWsLogger create WsLogger
@@ -32,19 +102,135 @@ func NewWsLogger(w http.ResponseWriter, r *http.Request, responseHeader http.Hea
 		return nil, err
 	}
 	session := &WsLogger{
-		wsConn: conn,
+		wsConn:   conn,
+		typed:    conn.Subprotocol() == Protocol,
+		controls: make(chan Control),
+		done:     make(chan struct{}),
 	}
+	go session.readLoop()
 	return session, nil
 }
 
+// Typed return whether client negotiated Protocol, otherwise it is a plain text client.
+func (l *WsLogger) Typed() bool {
+	return l.typed
+}
+
+// Controls return controls from client, pause and resume are handled by WsLogger itself.
+func (l *WsLogger) Controls() <-chan Control {
+	return l.controls
+}
+
+// Done return channel closed when client is gone.
+func (l *WsLogger) Done() <-chan struct{} {
+	return l.done
+}
+
+func (l *WsLogger) readLoop() {
+	defer close(l.done)
+	l.wsConn.SetReadLimit(maxControlSize)
+	for {
+		_, data, err := l.wsConn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var c Control
+		if err := json.Unmarshal(data, &c); err != nil {
+			// e.g. keystrokes of plain text clients.
+			continue
+		}
+		switch c.Operation {
+		case ControlPause:
+			l.pause()
+		case ControlResume:
+			l.resume()
+		case ControlFilter, ControlRestream, ControlContainer, ControlSnapshot:
+			select {
+			case l.controls <- c:
+			case <-l.done:
+			}
+		default:
+			l.Send(Frame{Type: FrameError, Data: fmt.Sprintf("unknown operation '%s'", c.Operation)})
+		}
+	}
+}
+
+func (l *WsLogger) pause() {
+	l.mu.Lock()
+	l.paused = true
+	l.mu.Unlock()
+	l.Send(Frame{Type: FrameStatus, Data: "paused"})
+}
+
+func (l *WsLogger) resume() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.paused {
+		return
+	}
+	l.paused = false
+	held, dropped := l.held, l.dropped
+	l.held, l.dropped = nil, 0
+	status := "resumed"
+	if dropped > 0 {
+		status = fmt.Sprintf("resumed, %d lines dropped while paused", dropped)
+	}
+	if err := l.sendLocked(Frame{Type: FrameStatus, Data: status}); err != nil {
+		return
+	}
+	for _, p := range held {
+		if err := l.sendLocked(Frame{Type: FrameLine, Data: string(p)}); err != nil {
+			return
+		}
+	}
+}
+
 // Write wirte bytes
 func (l *WsLogger) Write(p []byte) (n int, err error) {
-	if err := l.wsConn.WriteMessage(websocket.TextMessage, p); err != nil {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.paused {
+		if len(l.held) == maxPausedLines {
+			l.held = l.held[1:]
+			l.dropped++
+		}
+		l.held = append(l.held, append([]byte(nil), p...))
+		return len(p), nil
+	}
+	if err := l.sendLocked(Frame{Type: FrameLine, Data: string(p)}); err != nil {
 		return 0, err
 	}
 	return len(p), nil
 }
 
+// Status send status message to client.
+func (l *WsLogger) Status(msg string) error {
+	return l.Send(Frame{Type: FrameStatus, Data: msg})
+}
+
+// Error send error message to client.
+func (l *WsLogger) Error(msg string) error {
+	return l.Send(Frame{Type: FrameError, Data: msg})
+}
+
+// Send send frame to client, only data is sent to plain text clients.
+func (l *WsLogger) Send(f Frame) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sendLocked(f)
+}
+
+func (l *WsLogger) sendLocked(f Frame) error {
+	if !l.typed {
+		return l.wsConn.WriteMessage(websocket.TextMessage, []byte(f.Data))
+	}
+	b, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	return l.wsConn.WriteMessage(websocket.TextMessage, b)
+}
+
 // Close ws connection
 func (l *WsLogger) Close() error {
 	return l.wsConn.Close()
@@ -0,0 +1,113 @@
+package log_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	kubeLog "github.com/maoqide/kubeutil/pkg/kube/log"
+)
+
+// serveLogger serve a WsLogger to handle, and return client connection to it.
+func serveLogger(t *testing.T, protocols []string, handle func(*kubeLog.WsLogger)) *websocket.Conn {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writer, err := kubeLog.NewWsLogger(w, r, nil)
+		if err != nil {
+			t.Errorf("NewWsLogger: %v", err)
+			return
+		}
+		defer writer.Close()
+		handle(writer)
+	}))
+	t.Cleanup(server.Close)
+	dialer := websocket.Dialer{Subprotocols: protocols}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func readFrame(t *testing.T, conn *websocket.Conn) kubeLog.Frame {
+	t.Helper()
+	var f kubeLog.Frame
+	if err := conn.ReadJSON(&f); err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	return f
+}
+
+func TestWsLoggerTyped(t *testing.T) {
+	controls := make(chan kubeLog.Control, 1)
+	conn := serveLogger(t, []string{kubeLog.Protocol}, func(l *kubeLog.WsLogger) {
+		l.Write([]byte("first"))
+		controls <- <-l.Controls()
+		l.Status("restreaming")
+		<-l.Done()
+	})
+	if f := readFrame(t, conn); f.Type != kubeLog.FrameLine || f.Data != "first" {
+		t.Fatalf("unexpected frame %+v", f)
+	}
+	conn.WriteJSON(kubeLog.Control{Operation: "rewind"})
+	if f := readFrame(t, conn); f.Type != kubeLog.FrameError {
+		t.Fatalf("expect error frame of unknown operation, got %+v", f)
+	}
+	conn.WriteJSON(kubeLog.Control{Operation: kubeLog.ControlContainer, Container: "app"})
+	if f := readFrame(t, conn); f.Type != kubeLog.FrameStatus || f.Data != "restreaming" {
+		t.Fatalf("unexpected frame %+v", f)
+	}
+	if c := <-controls; c.Container != "app" {
+		t.Errorf("unexpected control %+v", c)
+	}
+}
+
+func TestWsLoggerPause(t *testing.T) {
+	paused, written := make(chan struct{}), make(chan struct{})
+	conn := serveLogger(t, []string{kubeLog.Protocol}, func(l *kubeLog.WsLogger) {
+		<-paused
+		l.Write([]byte("held 1"))
+		l.Write([]byte("held 2"))
+		close(written)
+		<-l.Done()
+	})
+	conn.WriteJSON(kubeLog.Control{Operation: kubeLog.ControlPause})
+	if f := readFrame(t, conn); f.Type != kubeLog.FrameStatus || f.Data != "paused" {
+		t.Fatalf("unexpected frame %+v", f)
+	}
+	close(paused)
+	// lines written while paused are sent after resumed.
+	<-written
+	conn.WriteJSON(kubeLog.Control{Operation: kubeLog.ControlResume})
+	var got []string
+	for i := 0; i < 3; i++ {
+		f := readFrame(t, conn)
+		got = append(got, f.Type+":"+f.Data)
+	}
+	want := "status:resumed,line:held 1,line:held 2"
+	if strings.Join(got, ",") != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+}
+
+func TestWsLoggerPlain(t *testing.T) {
+	conn := serveLogger(t, nil, func(l *kubeLog.WsLogger) {
+		l.Write([]byte("line"))
+		l.Error("failed")
+	})
+	for _, want := range []string{"line", "failed"} {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if string(data) != want {
+			t.Errorf("got %q, want %q", data, want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Options are options of a log request, mapped to corev1.PodLogOptions.
+// nil pointers are unset, e.g. all lines are returned if TailLines is nil.
+// json names are the same as query params.
+type Options struct {
+	Follow bool `json:"follow,omitempty"`
+	// TailLines number of lines from the end of the log, >= 0.
+	TailLines *int64 `json:"tail,omitempty"`
+	// SinceSeconds relative time in seconds before now, > 0, exclusive with SinceTime.
+	SinceSeconds *int64 `json:"sinceSeconds,omitempty"`
+	// SinceTime absolute time, exclusive with SinceSeconds.
+	SinceTime *time.Time `json:"sinceTime,omitempty"`
+	// Timestamps prefix lines with RFC3339 timestamps.
+	Timestamps bool `json:"timestamps,omitempty"`
+	// Previous log of the previous terminated container.
+	Previous bool `json:"previous,omitempty"`
+	// LimitBytes max bytes of the log, > 0.
+	LimitBytes *int64 `json:"limitBytes,omitempty"`
+	// InsecureSkipTLSVerifyBackend skip verifying kubelet serving certificate.
+	InsecureSkipTLSVerifyBackend bool `json:"insecureSkipTLSVerifyBackend,omitempty"`
+}
+
+// ParseOptions parse options from query params follow, tail, sinceSeconds, sinceTime, timestamps,
+// previous, limitBytes and insecureSkipTLSVerifyBackend, and validate them.
+func ParseOptions(query url.Values) (*Options, error) {
+	o := &Options{}
+	var errs []error
+	parseBool := func(key string, v *bool) {
+		s := query.Get(key)
+		if s == "" {
+			return
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s '%s', expect true or false", key, s))
+			return
+		}
+		*v = b
+	}
+	parseInt := func(key string) *int64 {
+		s := query.Get(key)
+		if s == "" {
+			return nil
+		}
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s '%s', expect integer", key, s))
+			return nil
+		}
+		return &i
+	}
+	parseBool("follow", &o.Follow)
+	parseBool("timestamps", &o.Timestamps)
+	parseBool("previous", &o.Previous)
+	parseBool("insecureSkipTLSVerifyBackend", &o.InsecureSkipTLSVerifyBackend)
+	o.TailLines = parseInt("tail")
+	o.SinceSeconds = parseInt("sinceSeconds")
+	o.LimitBytes = parseInt("limitBytes")
+	if s := query.Get("sinceTime"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid sinceTime '%s', expect RFC3339 time", s))
+		} else {
+			o.SinceTime = &t
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return o, o.Validate()
+}
+
+// Validate validate options like api server does.
+func (o *Options) Validate() error {
+	var errs []error
+	if o.TailLines != nil && *o.TailLines < 0 {
+		errs = append(errs, fmt.Errorf("tail must be greater than or equal to 0"))
+	}
+	if o.SinceSeconds != nil && *o.SinceSeconds < 1 {
+		errs = append(errs, fmt.Errorf("sinceSeconds must be greater than 0"))
+	}
+	if o.SinceSeconds != nil && o.SinceTime != nil {
+		errs = append(errs, fmt.Errorf("at most one of sinceSeconds and sinceTime could be set"))
+	}
+	if o.LimitBytes != nil && *o.LimitBytes < 1 {
+		errs = append(errs, fmt.Errorf("limitBytes must be greater than 0"))
+	}
+	return errors.Join(errs...)
+}
+
+// PodLogOptions return PodLogOptions of container.
+func (o *Options) PodLogOptions(container string) *corev1.PodLogOptions {
+	opts := &corev1.PodLogOptions{
+		Container:                    container,
+		Follow:                       o.Follow,
+		TailLines:                    o.TailLines,
+		SinceSeconds:                 o.SinceSeconds,
+		Timestamps:                   o.Timestamps,
+		Previous:                     o.Previous,
+		LimitBytes:                   o.LimitBytes,
+		InsecureSkipTLSVerifyBackend: o.InsecureSkipTLSVerifyBackend,
+	}
+	if o.SinceTime != nil {
+		opts.SinceTime = &metav1.Time{Time: *o.SinceTime}
+	}
+	return opts
+}
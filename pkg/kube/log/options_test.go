@@ -0,0 +1,47 @@
+package log_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	kubeLog "github.com/maoqide/kubeutil/pkg/kube/log"
+)
+
+func TestParseOptions(t *testing.T) {
+	query, _ := url.ParseQuery("follow=true&sinceTime=2024-01-01T00:00:00Z&timestamps=1&limitBytes=1024")
+	o, err := kubeLog.ParseOptions(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := o.PodLogOptions("app")
+	if !opts.Follow || !opts.Timestamps || opts.Container != "app" || *opts.LimitBytes != 1024 ||
+		opts.SinceTime.UTC().Format("2006-01-02") != "2024-01-01" {
+		t.Fatalf("unexpected options %+v", opts)
+	}
+	// missing tail returns the whole log.
+	if opts.TailLines != nil {
+		t.Fatalf("expect tail unset, got %d", *opts.TailLines)
+	}
+
+	// api server accepts following log of previous container.
+	query, _ = url.ParseQuery("previous=true&follow=true")
+	if _, err := kubeLog.ParseOptions(query); err != nil {
+		t.Fatalf("parse previous and follow: %v", err)
+	}
+
+	invalid := map[string]string{
+		"tail=-1":        "tail must be",
+		"tail=ten":       "invalid tail",
+		"sinceSeconds=0": "sinceSeconds must be",
+		"sinceSeconds=60&sinceTime=2024-01-01T00:00:00Z": "at most one",
+		"sinceTime=yesterday":                            "invalid sinceTime",
+		"follow=yes":                                     "invalid follow",
+	}
+	for raw, want := range invalid {
+		query, _ := url.ParseQuery(raw)
+		if _, err := kubeLog.ParseOptions(query); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("parse %s: expect error %q, got %v", raw, want, err)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	terminal "github.com/maoqide/kubeutil/pkg/terminal"
+	"github.com/maoqide/kubeutil/utils"
+)
+
+const (
+	// NodeShellLabel label of node shell pods, value is "true".
+	// node shell pods of a node are selected with field selector spec.nodeName as well,
+	// node names could be longer than label values allow.
+	NodeShellLabel = "kubeutil.io/node-shell"
+	// NodeShellNodeAnnotation annotation of node shell pods, value is the node name.
+	NodeShellNodeAnnotation = "kubeutil.io/node-shell-node"
+
+	defaultNodeShellNamespace = "default"
+	// node shell pod is killed after this long even if it is not deleted, e.g. server crashed.
+	defaultNodeShellLifetime = 12 * time.Hour
+	nodeShellContainerName   = "shell"
+	nodeShellDeleteTimeout   = 30 * time.Second
+)
+
+// NodeShellOptions options for node shell pod
+type NodeShellOptions struct {
+	// Image of node shell pod, must contain nsenter, DefaultDebugImage if empty.
+	Image string
+	// Namespace to create node shell pod in, "default" if empty.
+	Namespace string
+	// Command run in host namespaces, ["sh"] if empty.
+	Command []string
+	// Timeout waiting for node shell pod running.
+	Timeout time.Duration
+	// Lifetime is the activeDeadlineSeconds of node shell pod.
+	Lifetime time.Duration
+}
+
+// NodeShell create a privileged pod on node, exec Command into host namespaces with nsenter through it.
+// the pod is deleted when the session ends.
+func (b *PodBox) NodeShell(ctx context.Context, opts NodeShellOptions, ptyHandler terminal.PtyHandler, nodeName string) error {
+	if opts.Image == "" {
+		opts.Image = DefaultDebugImage
+	}
+	if opts.Namespace == "" {
+		opts.Namespace = defaultNodeShellNamespace
+	}
+	if len(opts.Command) == 0 {
+		opts.Command = []string{"sh"}
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultDebugTimeout
+	}
+	if opts.Lifetime == 0 {
+		opts.Lifetime = defaultNodeShellLifetime
+	}
+	pod, err := b.Create(ctx, nodeShellPod(opts, nodeName), opts.Namespace)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// session context may be canceled already.
+		ctx, cancel := context.WithTimeout(context.Background(), nodeShellDeleteTimeout)
+		defer cancel()
+		if err := b.Delete(ctx, pod.Name, pod.Namespace); err != nil {
+			log.Printf("delete node shell pod %s/%s err: %v", pod.Namespace, pod.Name, err)
+		}
+	}()
+	if err := b.waitPodRunning(ctx, pod.Namespace, pod.Name, opts.Timeout); err != nil {
+		return err
+	}
+	cmd := append([]string{"nsenter", "-t", "1", "-m", "-u", "-i", "-n", "--"}, opts.Command...)
+	return b.ExecWithContext(ctx, cmd, ptyHandler, pod.Namespace, pod.Name, nodeShellContainerName)
+}
+
+func nodeShellPod(opts NodeShellOptions, nodeName string) *corev1.Pod {
+	lifetime := int64(opts.Lifetime.Seconds())
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "node-shell-",
+			Namespace:    opts.Namespace,
+			Labels:       map[string]string{NodeShellLabel: "true"},
+			Annotations:  map[string]string{NodeShellNodeAnnotation: nodeName},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:                      nodeName,
+			HostPID:                       true,
+			HostNetwork:                   true,
+			HostIPC:                       true,
+			RestartPolicy:                 corev1.RestartPolicyNever,
+			ActiveDeadlineSeconds:         &lifetime,
+			TerminationGracePeriodSeconds: utils.Int64Ptr(0),
+			// run on tainted nodes as well, e.g. control plane or NotReady nodes.
+			Tolerations: []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+			Containers: []corev1.Container{{
+				Name:            nodeShellContainerName,
+				Image:           opts.Image,
+				Command:         []string{"sleep", fmt.Sprintf("%d", lifetime)},
+				ImagePullPolicy: corev1.PullIfNotPresent,
+				SecurityContext: &corev1.SecurityContext{Privileged: utils.BoolPtr(true)},
+			}},
+		},
+	}
+}
+
+func (b *PodBox) waitPodRunning(ctx context.Context, namespace, podName string, timeout time.Duration) error {
+	return wait.PollUntilContextTimeout(ctx, debugPollInterval, timeout, true, func(ctx context.Context) (bool, error) {
+		pod, err := b.Get(ctx, podName, namespace)
+		if err != nil {
+			return false, err
+		}
+		switch pod.Status.Phase {
+		case corev1.PodRunning:
+			return true, nil
+		case corev1.PodFailed, corev1.PodSucceeded:
+			return false, fmt.Errorf("pod %s/%s %s: %s", namespace, podName, pod.Status.Phase, pod.Status.Message)
+		}
+		for _, s := range pod.Status.ContainerStatuses {
+			if w := s.State.Waiting; w != nil && imagePullFailures[w.Reason] {
+				return false, fmt.Errorf("pod %s/%s container %s waiting: %s, %s", namespace, podName, s.Name, w.Reason, w.Message)
+			}
+		}
+		return false, nil
+	})
+}
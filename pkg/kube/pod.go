@@ -1,7 +1,6 @@
 package kube
 
 import (
-	"bufio"
 	"context"
 	"fmt"
 	"io"
@@ -16,8 +15,8 @@ import (
 	restclient "k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/remotecommand"
 
+	kubeLog "github.com/maoqide/kubeutil/pkg/kube/log"
 	terminal "github.com/maoqide/kubeutil/pkg/terminal"
-	"github.com/maoqide/kubeutil/utils"
 )
 
 // PodBox provide functions for kubernetes pod.
@@ -43,6 +42,11 @@ func (b *PodBox) List(ctx context.Context, namespace, labelSelector string) (*co
 	return b.clientset.CoreV1().Pods(namespace).List(ctx, opt)
 }
 
+// ListWithOptions list pods in namespace with opts, e.g. by field selector.
+func (b *PodBox) ListWithOptions(ctx context.Context, namespace string, opts metav1.ListOptions) (*corev1.PodList, error) {
+	return b.clientset.CoreV1().Pods(namespace).List(ctx, opts)
+}
+
 // Exists check if pod exists.
 func (b *PodBox) Exists(ctx context.Context, name, namespace string) (bool, error) {
 	_, err := b.Get(ctx, name, namespace)
@@ -65,6 +69,11 @@ func (b *PodBox) Watch(ctx context.Context, namespace string, timeoutSeconds *in
 	return b.clientset.CoreV1().Pods(namespace).Watch(ctx, opt)
 }
 
+// WatchWithOptions watch pods in namespace with opts, e.g. by field selector.
+func (b *PodBox) WatchWithOptions(ctx context.Context, namespace string, opts metav1.ListOptions) (watch.Interface, error) {
+	return b.clientset.CoreV1().Pods(namespace).Watch(ctx, opts)
+}
+
 // WatchPod watch specified pod in specified namespace with timeoutSeconds
 func (b *PodBox) WatchPod(ctx context.Context, namespace, podName string, timeoutSeconds *int64) (watch.Interface, error) {
 	pod, err := b.Get(ctx, podName, namespace)
@@ -82,6 +91,11 @@ func (b *PodBox) WatchPod(ctx context.Context, namespace, podName string, timeou
 
 // Exec exec into a pod
 func (b *PodBox) Exec(cmd []string, ptyHandler terminal.PtyHandler, namespace, podName, containerName string) error {
+	return b.ExecWithContext(context.TODO(), cmd, ptyHandler, namespace, podName, containerName)
+}
+
+// ExecWithContext exec into a pod, the stream is terminated when ctx done.
+func (b *PodBox) ExecWithContext(ctx context.Context, cmd []string, ptyHandler terminal.PtyHandler, namespace, podName, containerName string) error {
 
 	req := b.clientset.CoreV1().RESTClient().Post().
 		Resource("pods").
@@ -98,6 +112,37 @@ func (b *PodBox) Exec(cmd []string, ptyHandler terminal.PtyHandler, namespace, p
 		TTY:       ptyHandler.Tty(),
 	}, scheme.ParameterCodec)
 
+	return b.stream(ctx, req, ptyHandler)
+}
+
+// Attach attach to the main process of container in a pod.
+func (b *PodBox) Attach(ptyHandler terminal.PtyHandler, namespace, podName, containerName string) error {
+	return b.AttachWithContext(context.TODO(), ptyHandler, namespace, podName, containerName)
+}
+
+// AttachWithContext attach to the main process of container in a pod, the stream is terminated when ctx done.
+func (b *PodBox) AttachWithContext(ctx context.Context, ptyHandler terminal.PtyHandler, namespace, podName, containerName string) error {
+	req := b.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(podName).
+		Namespace(namespace).
+		SubResource("attach")
+
+	req.VersionedParams(&corev1.PodAttachOptions{
+		Container: containerName,
+		Stdin:     !(ptyHandler.Stdin() == nil),
+		Stdout:    !(ptyHandler.Stdout() == nil),
+		// stderr is merged into stdout by tty
+		Stderr: !(ptyHandler.Stderr() == nil) && !ptyHandler.Tty(),
+		TTY:    ptyHandler.Tty(),
+	}, scheme.ParameterCodec)
+
+	return b.stream(ctx, req, ptyHandler)
+}
+
+// stream connect ptyHandler to exec or attach request,
+// using websocket executor with fallback to spdy.
+func (b *PodBox) stream(ctx context.Context, req *restclient.Request, ptyHandler terminal.PtyHandler) error {
 	// executor, err := remotecommand.NewSPDYExecutor(b.config, "POST", req.URL())
 
 	executorWs, err := remotecommand.NewWebSocketExecutor(b.config, "POST", req.URL().String())
@@ -110,15 +155,17 @@ func (b *PodBox) Exec(cmd []string, ptyHandler terminal.PtyHandler, namespace, p
 	}
 
 	executor, err := remotecommand.NewFallbackExecutor(executorWs, executorSpdy, httpstream.IsUpgradeFailure)
+	if err != nil {
+		return err
+	}
 
-	err = executor.StreamWithContext(context.TODO(), remotecommand.StreamOptions{
+	return executor.StreamWithContext(ctx, remotecommand.StreamOptions{
 		Stdin:             ptyHandler.Stdin(),
 		Stdout:            ptyHandler.Stdout(),
 		Stderr:            ptyHandler.Stderr(),
 		TerminalSizeQueue: ptyHandler,
 		Tty:               ptyHandler.Tty(),
 	})
-	return err
 }
 
 // Logs get logs of specified pod in specified namespace.
@@ -138,7 +185,7 @@ func (b *PodBox) LogStream(ctx context.Context, name, namespace string, opts *co
 	return err
 }
 
-// LogStreamLine get logs of specified pod in specified namespace and copy to writer.
+// LogStreamLine get logs of specified pod in specified namespace and copy to writer line by line.
 func (b *PodBox) LogStreamLine(ctx context.Context, name, namespace string, opts *corev1.PodLogOptions, writer io.Writer) error {
 	req := b.Logs(name, namespace, opts)
 	r, err := req.Stream(ctx)
@@ -146,25 +193,7 @@ func (b *PodBox) LogStreamLine(ctx context.Context, name, namespace string, opts
 		return err
 	}
 	defer r.Close()
-	bufReader := bufio.NewReaderSize(r, 256)
-	// bufReader := bufio.NewReader(r)
-	for {
-		line, _, err := bufReader.ReadLine()
-		// line = []byte(fmt.Sprintf("%s", string(line)))
-		line = utils.ToValidUTF8(line, []byte(""))
-		if err != nil {
-			if err == io.EOF {
-				_, err = writer.Write(line)
-			}
-			return err
-		}
-		// line = append(line, []byte("\r\n")...)
-		// line = append(bytes.Trim(line, " "), []byte("\r\n")...)
-		_, err = writer.Write(line)
-		if err != nil {
-			return err
-		}
-	}
+	return kubeLog.CopyLines(r, writer)
 }
 
 // Delete delete pod
@@ -0,0 +1,96 @@
+package kube
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+)
+
+// SecretBox provide functions for kubernetes secret.
+type SecretBox struct {
+	clientset clientset.Interface
+}
+
+// NewSecretBoxWithClient creates a SecretBox
+func NewSecretBoxWithClient(c *clientset.Interface) *SecretBox {
+	return &SecretBox{clientset: *c}
+}
+
+// Get get specified secret in specified namespace.
+func (b *SecretBox) Get(ctx context.Context, name, namespace string) (*corev1.Secret, error) {
+	opt := metav1.GetOptions{}
+	return b.clientset.CoreV1().Secrets(namespace).Get(ctx, name, opt)
+}
+
+// PodSecretValues get values of secrets the pod uses, by volumes, projected volumes, env and envFrom.
+// secrets not found are skipped, as the pod may reference optional ones.
+func (b *SecretBox) PodSecretValues(ctx context.Context, pod *corev1.Pod) ([]string, error) {
+	// secret name to referenced keys, nil for all keys.
+	refs := map[string][]string{}
+	all := map[string]bool{}
+	addAll := func(name string) {
+		all[name] = true
+	}
+	addKey := func(name, key string) {
+		refs[name] = append(refs[name], key)
+	}
+	for _, v := range pod.Spec.Volumes {
+		if v.Secret != nil {
+			addAll(v.Secret.SecretName)
+		}
+		if v.Projected != nil {
+			for _, s := range v.Projected.Sources {
+				if s.Secret != nil {
+					addAll(s.Secret.Name)
+				}
+			}
+		}
+	}
+	var containers []corev1.Container
+	containers = append(containers, pod.Spec.InitContainers...)
+	containers = append(containers, pod.Spec.Containers...)
+	for _, c := range pod.Spec.EphemeralContainers {
+		containers = append(containers, corev1.Container(c.EphemeralContainerCommon))
+	}
+	for _, c := range containers {
+		for _, e := range c.EnvFrom {
+			if e.SecretRef != nil {
+				addAll(e.SecretRef.Name)
+			}
+		}
+		for _, e := range c.Env {
+			if e.ValueFrom != nil && e.ValueFrom.SecretKeyRef != nil {
+				addKey(e.ValueFrom.SecretKeyRef.Name, e.ValueFrom.SecretKeyRef.Key)
+			}
+		}
+	}
+	for name := range all {
+		refs[name] = nil
+	}
+
+	var values []string
+	for name, keys := range refs {
+		secret, err := b.Get(ctx, name, pod.Namespace)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if keys == nil {
+			for _, v := range secret.Data {
+				values = append(values, string(v))
+			}
+			continue
+		}
+		for _, k := range keys {
+			if v, ok := secret.Data[k]; ok {
+				values = append(values, string(v))
+			}
+		}
+	}
+	return values, nil
+}
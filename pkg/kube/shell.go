@@ -0,0 +1,38 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/maoqide/kubeutil/pkg/terminal"
+	stream_terminal "github.com/maoqide/kubeutil/pkg/terminal/stream"
+)
+
+// time allowed for probing a single shell
+const shellProbeTimeout = 10 * time.Second
+
+// DetectShell return the first of shells which could be executed in container.
+func (b *PodBox) DetectShell(ctx context.Context, shells [][]string, namespace, podName, containerName string) ([]string, error) {
+	var lastErr error
+	for _, shell := range shells {
+		session := stream_terminal.NewTerminalSession(
+			stream_terminal.IOStreams{
+				Out:    io.Discard,
+				ErrOut: io.Discard,
+			})
+		probeCtx, cancel := context.WithTimeout(ctx, shellProbeTimeout)
+		err := b.ExecWithContext(probeCtx, terminal.ProbeCommand(shell), session, namespace, podName, containerName)
+		cancel()
+		session.Done()
+		if err == nil {
+			return shell, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("no available shell in container, last err: %v", lastErr)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	patchtypes "k8s.io/apimachinery/pkg/types"
@@ -116,3 +117,17 @@ func (b *StatefulSetBox) GetLatestReplicaSet(ctx context.Context, name, namespac
 	}
 	return nil, "", fmt.Errorf("lastest replicaset(that revision corresponding to sts) hasn't been created yet")
 }
+
+// GetPods get pods of sts
+func (b *StatefulSetBox) GetPods(ctx context.Context, name, namespace string) (*corev1.PodList, error) {
+	sts, err := b.Get(ctx, name, namespace)
+	if err != nil {
+		return nil, err
+	}
+	labelSelector, err := metav1.LabelSelectorAsSelector(sts.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	opt := metav1.ListOptions{LabelSelector: labelSelector.String()}
+	return b.clientset.CoreV1().Pods(namespace).List(ctx, opt)
+}
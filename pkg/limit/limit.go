@@ -0,0 +1,115 @@
+package limit
+
+import (
+	"fmt"
+	"sync"
+)
+
+// limit scopes
+const (
+	ScopeGlobal = "global"
+	ScopeUser   = "user"
+	ScopePod    = "pod"
+)
+
+// Limits of concurrent usage, 0 for unlimited.
+type Limits struct {
+	Global  int `json:"global"`
+	PerUser int `json:"perUser"`
+	PerPod  int `json:"perPod"`
+}
+
+// Error is returned when acquiring beyond a limit.
+type Error struct {
+	// Resource limited, e.g. terminal sessions
+	Resource string
+	Scope    string
+	// Key of the scope, user or pod name, empty for global
+	Key   string
+	Limit int
+}
+
+func (e *Error) Error() string {
+	if e.Scope == ScopeGlobal {
+		return fmt.Sprintf("too many concurrent %s (limit %d)", e.Resource, e.Limit)
+	}
+	return fmt.Sprintf("too many concurrent %s for %s %s (limit %d)", e.Resource, e.Scope, e.Key, e.Limit)
+}
+
+// Usage is the current usage of a Limiter.
+type Usage struct {
+	Limits Limits         `json:"limits"`
+	Global int            `json:"global"`
+	Users  map[string]int `json:"users"`
+	Pods   map[string]int `json:"pods"`
+}
+
+// Limiter limits concurrent usage of a resource per user, per pod and globally.
+// It is safe for concurrent use.
+type Limiter struct {
+	resource string
+	limits   Limits
+
+	mu     sync.Mutex
+	global int
+	users  map[string]int
+	pods   map[string]int
+}
+
+// New create Limiter of resource, resource is used in error messages, e.g. "log streams".
+func New(resource string, limits Limits) *Limiter {
+	return &Limiter{
+		resource: resource,
+		limits:   limits,
+		users:    map[string]int{},
+		pods:     map[string]int{},
+	}
+}
+
+// Acquire acquire a slot for user on pod, release must be called once done.
+// err is *Error if any limit is reached.
+func (l *Limiter) Acquire(user, pod string) (release func(), err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch {
+	case l.limits.Global > 0 && l.global >= l.limits.Global:
+		return nil, &Error{Resource: l.resource, Scope: ScopeGlobal, Limit: l.limits.Global}
+	case l.limits.PerUser > 0 && l.users[user] >= l.limits.PerUser:
+		return nil, &Error{Resource: l.resource, Scope: ScopeUser, Key: user, Limit: l.limits.PerUser}
+	case l.limits.PerPod > 0 && l.pods[pod] >= l.limits.PerPod:
+		return nil, &Error{Resource: l.resource, Scope: ScopePod, Key: pod, Limit: l.limits.PerPod}
+	}
+	l.global++
+	l.users[user]++
+	l.pods[pod]++
+	var once sync.Once
+	return func() {
+		once.Do(func() { l.release(user, pod) })
+	}, nil
+}
+
+func (l *Limiter) release(user, pod string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.global--
+	if l.users[user]--; l.users[user] <= 0 {
+		delete(l.users, user)
+	}
+	if l.pods[pod]--; l.pods[pod] <= 0 {
+		delete(l.pods, pod)
+	}
+}
+
+// Usage return current usage.
+func (l *Limiter) Usage() Usage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	u := Usage{Limits: l.limits, Global: l.global, Users: map[string]int{}, Pods: map[string]int{}}
+	for k, v := range l.users {
+		u.Users[k] = v
+	}
+	for k, v := range l.pods {
+		u.Pods[k] = v
+	}
+	return u
+}
@@ -0,0 +1,39 @@
+package limit_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/maoqide/kubeutil/pkg/limit"
+)
+
+func TestLimiter(t *testing.T) {
+	l := limit.New("log streams", limit.Limits{Global: 4, PerUser: 2, PerPod: 2})
+	acquire := func(user, pod, scope string) func() {
+		t.Helper()
+		release, err := l.Acquire(user, pod)
+		var limitErr *limit.Error
+		switch {
+		case scope == "" && err != nil:
+			t.Fatalf("acquire %s %s: %v", user, pod, err)
+		case scope != "" && (!errors.As(err, &limitErr) || limitErr.Scope != scope):
+			t.Fatalf("acquire %s %s: expect %s limit, got %v", user, pod, scope, err)
+		}
+		return release
+	}
+	r1 := acquire("alice", "default/a", "")
+	acquire("alice", "default/b", "")
+	acquire("alice", "default/c", limit.ScopeUser)
+	acquire("bob", "default/a", "")
+	acquire("carol", "default/a", limit.ScopePod)
+	acquire("carol", "default/c", "")
+	acquire("dave", "default/d", limit.ScopeGlobal)
+
+	// release is idempotent.
+	r1()
+	r1()
+	if u := l.Usage(); u.Global != 3 || u.Users["alice"] != 1 || u.Pods["default/a"] != 1 {
+		t.Fatalf("unexpected usage %+v", u)
+	}
+	acquire("dave", "default/d", "")
+}
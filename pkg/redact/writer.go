@@ -0,0 +1,97 @@
+package redact
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// FlushDelay held back output is written out if no more output follows within this long.
+	FlushDelay = 20 * time.Millisecond
+
+	// maxHold caps trailing bytes held back for pattern matching.
+	maxHold = 4096
+)
+
+// Writer masks secrets in output written through it. To catch secrets split across writes,
+// a trailing part which may be the beginning of a secret is held back until more output arrives,
+// or FlushDelay elapsed, or Flush is called. Writer is safe for concurrent use.
+type Writer struct {
+	mu    sync.Mutex
+	w     io.Writer
+	r     *Redactor
+	held  []byte
+	timer *time.Timer
+	err   error
+}
+
+// NewWriter create Writer masking secrets of r in output to w.
+func NewWriter(w io.Writer, r *Redactor) *Writer {
+	return &Writer{w: w, r: r}
+}
+
+// Write mask secrets in p and write to the underlying writer, at most one write per call.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return 0, w.err
+	}
+	data := append(w.held, p...)
+	i := w.r.holdFrom(data, maxHold)
+	w.held = append([]byte(nil), data[i:]...)
+	if len(w.held) > 0 {
+		if w.timer == nil {
+			w.timer = time.AfterFunc(FlushDelay, func() { w.Flush() })
+		} else {
+			w.timer.Reset(FlushDelay)
+		}
+	}
+	if i == 0 {
+		return len(p), nil
+	}
+	if _, err := w.w.Write(w.r.Redact(data[:i])); err != nil {
+		w.err = err
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush write out held back output.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	if w.err != nil || len(w.held) == 0 {
+		return w.err
+	}
+	held := w.held
+	w.held = nil
+	if _, err := w.w.Write(w.r.Redact(held)); err != nil {
+		w.err = err
+	}
+	return w.err
+}
+
+// LineWriter masks secrets in output written line by line, e.g. logs.
+// each write is a complete line, e.g. written by LogStreamLine, and masked by itself, nothing is held back.
+type LineWriter struct {
+	w io.Writer
+	r *Redactor
+}
+
+// NewLineWriter create LineWriter masking secrets of r in lines written to w.
+func NewLineWriter(w io.Writer, r *Redactor) *LineWriter {
+	return &LineWriter{w: w, r: r}
+}
+
+// Write mask secrets in line p and write it to the underlying writer.
+func (w *LineWriter) Write(p []byte) (int, error) {
+	if _, err := w.w.Write(w.r.Redact(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,134 @@
+package policy
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// control keys
+const (
+	keyInterrupt = 0x03
+	keyBackspace = 0x08
+	keyTab       = 0x09
+	keyLineFeed  = 0x0a
+	keyEnter     = 0x0d
+	keyKillLine  = 0x15
+	keyKillWord  = 0x17
+	keyEscape    = 0x1b
+	keyDelete    = 0x7f
+)
+
+var (
+	bracketedPasteStart = []byte("\x1b[200~")
+	bracketedPasteEnd   = []byte("\x1b[201~")
+)
+
+// Filter reconstructs command lines from terminal keystrokes and checks them with Policy
+// when they are submitted. It is best effort: line editing by history, tab completion or
+// cursor movement could not be followed, such lines are marked uncertain, see Rule.Strict.
+// Filter is not safe for concurrent use.
+type Filter struct {
+	policy    *Policy
+	namespace string
+	// OnViolation is called for every line violating policy, blocked or not.
+	OnViolation func(line string, d Decision)
+
+	line      []byte
+	uncertain bool
+	// escape sequence in progress
+	escape []byte
+}
+
+// NewFilter create Filter checking lines submitted in namespace.
+func NewFilter(policy *Policy, namespace string) *Filter {
+	return &Filter{policy: policy, namespace: namespace}
+}
+
+// Filter process keystrokes in p, return input to pass on to the shell and reply to show to the user.
+// a blocked line is replaced by kill line (ctrl-u), so that the shell discards it.
+func (f *Filter) Filter(p []byte) (pass []byte, reply []byte) {
+	pass = make([]byte, 0, len(p))
+	for _, b := range p {
+		if f.escape != nil {
+			f.escape = append(f.escape, b)
+			if escapeDone(f.escape) {
+				f.endEscape()
+			}
+			pass = append(pass, b)
+			continue
+		}
+		switch b {
+		case keyEnter, keyLineFeed:
+			line := strings.TrimSpace(string(f.line))
+			uncertain := f.uncertain
+			f.reset()
+			if line == "" && !uncertain {
+				break
+			}
+			d := f.policy.Check(f.namespace, line, uncertain)
+			if d.Allowed {
+				break
+			}
+			if f.OnViolation != nil {
+				f.OnViolation(line, d)
+			}
+			if d.Action == ActionBlock {
+				pass = append(pass, keyKillLine)
+				reply = append(reply, fmt.Sprintf("\r\n[command blocked by policy: %s]\r\n", d.Rule)...)
+				continue
+			}
+		case keyInterrupt, keyKillLine:
+			f.reset()
+		case keyBackspace, keyDelete:
+			if _, size := utf8.DecodeLastRune(f.line); size > 0 {
+				f.line = f.line[:len(f.line)-size]
+			}
+		case keyKillWord:
+			trimmed := bytes.TrimRight(f.line, " ")
+			f.line = trimmed[:bytes.LastIndexByte(trimmed, ' ')+1]
+		case keyTab:
+			f.uncertain = true
+		case keyEscape:
+			f.escape = []byte{b}
+		default:
+			if b >= 0x20 || b == '\t' {
+				f.line = append(f.line, b)
+			}
+		}
+		pass = append(pass, b)
+	}
+	return pass, reply
+}
+
+func (f *Filter) reset() {
+	f.line = f.line[:0]
+	f.uncertain = false
+}
+
+// endEscape handle a complete escape sequence, pasted text is part of the line,
+// any other sequence edits the line in unknown ways.
+func (f *Filter) endEscape() {
+	if !bytes.Equal(f.escape, bracketedPasteStart) && !bytes.Equal(f.escape, bracketedPasteEnd) {
+		f.uncertain = true
+	}
+	f.escape = nil
+}
+
+// escapeDone return whether seq is a complete escape sequence:
+// ESC [ params final, ESC O final, or ESC followed by a single key (alt+key).
+func escapeDone(seq []byte) bool {
+	if len(seq) < 2 {
+		return false
+	}
+	switch seq[1] {
+	case '[':
+		last := seq[len(seq)-1]
+		return len(seq) > 2 && last >= 0x40 && last <= 0x7e
+	case 'O':
+		return len(seq) > 2
+	default:
+		return true
+	}
+}
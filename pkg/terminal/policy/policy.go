@@ -0,0 +1,196 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// rule actions
+const (
+	// ActionBlock keep the command line from reaching the shell
+	ActionBlock = "block"
+	// ActionAudit let the command line through, only report it
+	ActionAudit = "audit"
+)
+
+// Rule checks command lines submitted in namespaces.
+// a line violates the rule if it matches any of Deny, or Allow is not empty and it matches none of Allow.
+type Rule struct {
+	Name string `json:"name,omitempty"`
+	// Namespaces glob patterns the rule applies to, all namespaces if empty.
+	Namespaces []string `json:"namespaces,omitempty"`
+	Allow      []string `json:"allow,omitempty"`
+	Deny       []string `json:"deny,omitempty"`
+	// Action on violation, block or audit, block if empty.
+	Action string `json:"action,omitempty"`
+	// Strict treat lines edited in ways that could not be reconstructed, e.g. history or
+	// tab completion, as violations. Without it such lines are checked as far as they are known.
+	Strict bool `json:"strict,omitempty"`
+}
+
+// Config is the policy file format.
+type Config struct {
+	Rules []Rule `json:"rules"`
+}
+
+type compiledRule struct {
+	Rule
+	allow []*regexp.Regexp
+	deny  []*regexp.Regexp
+}
+
+// Policy checks command lines against rules. It is immutable and safe for concurrent use.
+type Policy struct {
+	rules []compiledRule
+}
+
+// Decision is the result of checking a command line.
+type Decision struct {
+	// Allowed is false if any rule is violated.
+	Allowed bool
+	// Action of the violated rule, block wins over audit.
+	Action string
+	// Rule name, or the matched deny pattern if unnamed.
+	Rule string
+}
+
+// Parse parse policy from yaml or json.
+func Parse(data []byte) (*Policy, error) {
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, err
+	}
+	return New(config)
+}
+
+// New compile policy of config.
+func New(config Config) (*Policy, error) {
+	p := &Policy{}
+	for i, r := range config.Rules {
+		switch r.Action {
+		case "":
+			r.Action = ActionBlock
+		case ActionBlock, ActionAudit:
+		default:
+			return nil, fmt.Errorf("rule %d: unknown action '%s'", i, r.Action)
+		}
+		for _, ns := range r.Namespaces {
+			if _, err := path.Match(ns, ""); err != nil {
+				return nil, fmt.Errorf("rule %d: invalid namespace pattern '%s'", i, ns)
+			}
+		}
+		c := compiledRule{Rule: r}
+		for _, expr := range r.Allow {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %v", i, err)
+			}
+			c.allow = append(c.allow, re)
+		}
+		for _, expr := range r.Deny {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %v", i, err)
+			}
+			c.deny = append(c.deny, re)
+		}
+		p.rules = append(p.rules, c)
+	}
+	return p, nil
+}
+
+// LoadFile load policy from yaml or json file.
+func LoadFile(name string) (*Policy, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// LoadConfigMap load policy from key of ConfigMap namespace/name.
+func LoadConfigMap(ctx context.Context, clientset kubernetes.Interface, namespace, name, key string) (*Policy, error) {
+	cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	data, ok := cm.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("key %s not found in configmap %s/%s", key, namespace, name)
+	}
+	return Parse([]byte(data))
+}
+
+// Applies return whether any rule applies to namespace.
+func (p *Policy) Applies(namespace string) bool {
+	for _, r := range p.rules {
+		if r.applies(namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check check line submitted in namespace, uncertain if the line could not be fully reconstructed.
+func (p *Policy) Check(namespace, line string, uncertain bool) Decision {
+	d := Decision{Allowed: true}
+	for _, r := range p.rules {
+		if !r.applies(namespace) {
+			continue
+		}
+		name, violated := r.violated(line, uncertain)
+		if !violated {
+			continue
+		}
+		if d.Allowed || (d.Action == ActionAudit && r.Action == ActionBlock) {
+			d = Decision{Allowed: false, Action: r.Action, Rule: name}
+		}
+	}
+	return d
+}
+
+func (r compiledRule) applies(namespace string) bool {
+	if len(r.Namespaces) == 0 {
+		return true
+	}
+	for _, ns := range r.Namespaces {
+		if ok, _ := path.Match(ns, namespace); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// violated return name of the violated rule if line violates r.
+func (r compiledRule) violated(line string, uncertain bool) (string, bool) {
+	name := func(detail string) string {
+		if r.Name != "" {
+			return r.Name
+		}
+		return detail
+	}
+	if uncertain && r.Strict {
+		return name("line could not be reconstructed"), true
+	}
+	for _, re := range r.deny {
+		if re.MatchString(line) {
+			return name(re.String()), true
+		}
+	}
+	if len(r.allow) == 0 {
+		return "", false
+	}
+	for _, re := range r.allow {
+		if re.MatchString(line) {
+			return "", false
+		}
+	}
+	return name("not allowed"), true
+}
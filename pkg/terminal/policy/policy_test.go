@@ -0,0 +1,99 @@
+package policy_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maoqide/kubeutil/pkg/terminal/policy"
+)
+
+const testPolicy = `
+rules:
+- name: no-delete
+  namespaces: ["prod-*"]
+  deny: ["^rm\\s+-rf", "kubectl\\s+delete"]
+- name: readonly
+  namespaces: ["finance"]
+  allow: ["^(ls|cat|ps)\\b"]
+  strict: true
+- name: curl
+  deny: ["\\bcurl\\b"]
+  action: audit
+`
+
+func TestPolicyCheck(t *testing.T) {
+	p, err := policy.Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		namespace string
+		line      string
+		uncertain bool
+		allowed   bool
+		action    string
+	}{
+		{"prod-eu", "rm -rf /", false, false, policy.ActionBlock},
+		{"dev", "rm -rf /", false, true, ""},
+		{"prod-eu", "ls -l", false, true, ""},
+		{"prod-eu", "curl example.com", false, false, policy.ActionAudit},
+		{"finance", "cat /etc/hosts", false, true, ""},
+		{"finance", "vi /etc/hosts", false, false, policy.ActionBlock},
+		{"finance", "ls", true, false, policy.ActionBlock},
+		{"finance", "curl example.com", false, false, policy.ActionBlock},
+	}
+	for _, c := range cases {
+		d := p.Check(c.namespace, c.line, c.uncertain)
+		if d.Allowed != c.allowed || d.Action != c.action {
+			t.Errorf("check %s %q: unexpected decision %+v", c.namespace, c.line, d)
+		}
+	}
+	if _, err := policy.Parse([]byte("rules:\n- action: kill\n")); err == nil {
+		t.Error("expect error for unknown action")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	p, err := policy.Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var denied []string
+	f := policy.NewFilter(p, "prod-eu")
+	f.OnViolation = func(line string, d policy.Decision) {
+		denied = append(denied, line)
+	}
+
+	// typed with a typo fixed by backspace, split across reads.
+	pass, reply := f.Filter([]byte("rm -rx\x7ff"))
+	if string(pass) != "rm -rx\x7ff" || len(reply) != 0 {
+		t.Fatalf("unexpected pass %q, reply %q", pass, reply)
+	}
+	pass, reply = f.Filter([]byte(" /\r"))
+	if string(pass) != " /\x15" || !strings.Contains(string(reply), "no-delete") {
+		t.Fatalf("expect blocked, got pass %q, reply %q", pass, reply)
+	}
+
+	// line is reset after ctrl-u.
+	pass, _ = f.Filter([]byte("rm -rf\x15ls\r"))
+	if string(pass) != "rm -rf\x15ls\r" {
+		t.Fatalf("expect passed, got %q", pass)
+	}
+
+	// pasted text is part of the line.
+	pass, _ = f.Filter([]byte("\x1b[200~kubectl delete pod x\x1b[201~\r"))
+	if !strings.HasSuffix(string(pass), "\x15") {
+		t.Fatalf("expect pasted line blocked, got %q", pass)
+	}
+
+	// audit only.
+	pass, reply = f.Filter([]byte("curl example.com\r"))
+	if !strings.HasSuffix(string(pass), "\r") || len(reply) != 0 {
+		t.Fatalf("expect audited line passed, got pass %q, reply %q", pass, reply)
+	}
+
+	want := []string{"rm -rf /", "kubectl delete pod x", "curl example.com"}
+	if strings.Join(denied, ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected violations: %q", denied)
+	}
+}
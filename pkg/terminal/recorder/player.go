@@ -0,0 +1,198 @@
+package recorder
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	// ControlSpeed change playback speed, Value is the speed multiplier.
+	ControlSpeed = "speed"
+	// ControlSeek jump to position, Value is seconds from the beginning of recording,
+	// or from current position if Relative.
+	ControlSeek = "seek"
+	// ControlPause pause playback.
+	ControlPause = "pause"
+	// ControlResume resume paused playback.
+	ControlResume = "resume"
+
+	// terminal reset sequence, clears screen before replaying from an earlier position.
+	resetSequence = "\x1bc"
+
+	maxSpeed = 64
+)
+
+// Control is a playback control command.
+type Control struct {
+	Operation string
+	Value     float64
+	Relative  bool
+}
+
+// Player replays a recording with its original timing.
+type Player struct {
+	header Header
+	events []Event
+	speed  float64
+}
+
+// NewPlayer load recording from r, only output and resize events are kept.
+func NewPlayer(r io.Reader) (*Player, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("empty recording")
+	}
+	p := &Player{speed: 1}
+	if err := json.Unmarshal(scanner.Bytes(), &p.header); err != nil {
+		return nil, fmt.Errorf("invalid recording header: %v", err)
+	}
+	if p.header.Version != formatVersion {
+		return nil, fmt.Errorf("unsupported recording version %d", p.header.Version)
+	}
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("invalid recording event: %v", err)
+		}
+		if e.Code == EventOutput || e.Code == EventResize {
+			p.events = append(p.events, e)
+		}
+	}
+	return p, scanner.Err()
+}
+
+// Header return header of recording.
+func (p *Player) Header() Header {
+	return p.header
+}
+
+// Duration return duration of recording.
+func (p *Player) Duration() time.Duration {
+	if len(p.events) == 0 {
+		return 0
+	}
+	return seconds(p.events[len(p.events)-1].Time)
+}
+
+// Play send events to out with the original timing, until recording ends or ctx done.
+// Controls received from ctl adjust speed, position and pause state.
+func (p *Player) Play(ctx context.Context, ctl <-chan Control, out func(Event) error) error {
+	var (
+		i      int
+		pos    float64 // current position in recording, in seconds
+		paused bool
+		timer  = time.NewTimer(0)
+	)
+	defer timer.Stop()
+	<-timer.C
+
+	// wall clock time when pos was last updated
+	last := time.Now()
+	for i < len(p.events) {
+		if !paused {
+			wait := seconds((p.events[i].Time - pos) / p.speed)
+			timer.Reset(wait)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			pos = p.events[i].Time
+			last = time.Now()
+			if err := out(p.events[i]); err != nil {
+				return err
+			}
+			i++
+			continue
+		case c, ok := <-ctl:
+			if !ok {
+				// no more controls, go on playing.
+				ctl = nil
+			}
+			if !paused {
+				pos += time.Since(last).Seconds() * p.speed
+			}
+			last = time.Now()
+			var err error
+			switch c.Operation {
+			case ControlSpeed:
+				if c.Value > 0 && c.Value <= maxSpeed {
+					p.speed = c.Value
+				}
+			case ControlPause:
+				paused = true
+			case ControlResume:
+				paused = false
+			case ControlSeek:
+				target := c.Value
+				if c.Relative {
+					target += pos
+				}
+				i, pos, err = p.seek(i, pos, target, out)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+	}
+	return nil
+}
+
+// seek output all events between position and target at once, restart from beginning if seek backward.
+func (p *Player) seek(i int, pos, target float64, out func(Event) error) (int, float64, error) {
+	if target < 0 {
+		target = 0
+	}
+	var buf strings.Builder
+	if target < pos {
+		i = 0
+		buf.WriteString(resetSequence)
+	}
+	for ; i < len(p.events) && p.events[i].Time <= target; i++ {
+		e := p.events[i]
+		if e.Code == EventResize {
+			if err := p.flush(&buf, target, out); err != nil {
+				return i, target, err
+			}
+			if err := out(e); err != nil {
+				return i, target, err
+			}
+			continue
+		}
+		buf.WriteString(e.Data)
+	}
+	return i, target, p.flush(&buf, target, out)
+}
+
+func (p *Player) flush(buf *strings.Builder, pos float64, out func(Event) error) error {
+	if buf.Len() == 0 {
+		return nil
+	}
+	defer buf.Reset()
+	return out(Event{Time: pos, Code: EventOutput, Data: buf.String()})
+}
+
+func seconds(s float64) time.Duration {
+	if s < 0 {
+		return 0
+	}
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,169 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// asciicast v2 format, https://docs.asciinema.org/manual/asciicast/v2/
+	formatVersion = 2
+
+	// EventOutput data written to the terminal
+	EventOutput = "o"
+	// EventInput data read from the terminal
+	EventInput = "i"
+	// EventResize terminal resized, data is formatted as "{COLS}x{ROWS}"
+	EventResize = "r"
+	// EventMarker marker with label as data
+	EventMarker = "m"
+
+	defaultWidth  = 80
+	defaultHeight = 24
+)
+
+// Meta describes a recorded terminal session.
+type Meta struct {
+	SessionID string    `json:"id"`
+	Namespace string    `json:"namespace"`
+	Pod       string    `json:"pod"`
+	Container string    `json:"container"`
+	User      string    `json:"user,omitempty"`
+	StartTime time.Time `json:"startTime"`
+}
+
+// Header is the first line of an asciicast v2 file.
+// Session is not part of the asciicast spec, players ignore unknown keys.
+type Header struct {
+	Version   int               `json:"version"`
+	Width     uint16            `json:"width"`
+	Height    uint16            `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+	Session   *Meta             `json:"session,omitempty"`
+}
+
+// Event is a single asciicast v2 event line, encoded as [time, code, data].
+type Event struct {
+	Time float64
+	Code string
+	Data string
+}
+
+// MarshalJSON encode event as json array
+func (e Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{e.Time, e.Code, e.Data})
+}
+
+// UnmarshalJSON decode event from json array
+func (e *Event) UnmarshalJSON(b []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if len(raw) != 3 {
+		return fmt.Errorf("invalid event: expected 3 elements, got %d", len(raw))
+	}
+	if err := json.Unmarshal(raw[0], &e.Time); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw[1], &e.Code); err != nil {
+		return err
+	}
+	return json.Unmarshal(raw[2], &e.Data)
+}
+
+// Recorder writes terminal session events in asciicast v2 format.
+// It is safe for concurrent use.
+type Recorder struct {
+	mu     sync.Mutex
+	w      io.WriteCloser
+	enc    *json.Encoder
+	start  time.Time
+	err    error
+	closed bool
+}
+
+// New create a Recorder writing to the writer created by sink for meta.
+func New(sink Sink, meta Meta) (*Recorder, error) {
+	if meta.StartTime.IsZero() {
+		meta.StartTime = time.Now()
+	}
+	w, err := sink.Create(meta)
+	if err != nil {
+		return nil, err
+	}
+	r := &Recorder{
+		w:     w,
+		enc:   json.NewEncoder(w),
+		start: meta.StartTime,
+	}
+	header := Header{
+		Version:   formatVersion,
+		Width:     defaultWidth,
+		Height:    defaultHeight,
+		Timestamp: meta.StartTime.Unix(),
+		Title:     fmt.Sprintf("%s/%s/%s", meta.Namespace, meta.Pod, meta.Container),
+		Env:       map[string]string{"TERM": "xterm"},
+		Session:   &meta,
+	}
+	if err := r.enc.Encode(header); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Output record data written to the terminal.
+func (r *Recorder) Output(p []byte) {
+	r.record(EventOutput, string(p))
+}
+
+// Input record data read from the terminal.
+func (r *Recorder) Input(p []byte) {
+	r.record(EventInput, string(p))
+}
+
+// Resize record terminal resize.
+func (r *Recorder) Resize(cols, rows uint16) {
+	r.record(EventResize, fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// Marker record a marker, e.g. why the session ended.
+func (r *Recorder) Marker(label string) {
+	r.record(EventMarker, label)
+}
+
+func (r *Recorder) record(code, data string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed || r.err != nil {
+		return
+	}
+	e := Event{
+		Time: time.Since(r.start).Seconds(),
+		Code: code,
+		Data: data,
+	}
+	if err := r.enc.Encode(e); err != nil {
+		// stop recording on the first failure, terminal session goes on.
+		log.Printf("record event err: %v", err)
+		r.err = err
+	}
+}
+
+// Close flush and close the underlying writer.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	return r.w.Close()
+}
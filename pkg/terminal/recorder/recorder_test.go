@@ -0,0 +1,120 @@
+package recorder_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maoqide/kubeutil/pkg/terminal/recorder"
+)
+
+func TestRecorder(t *testing.T) {
+	dir := t.TempDir()
+	meta := recorder.Meta{
+		SessionID: "abc",
+		Namespace: "default",
+		Pod:       "nginx",
+		Container: "nginx",
+	}
+	sink := recorder.NewDirSink(dir)
+	rec, err := recorder.New(sink, meta)
+	if err != nil {
+		t.Fatalf("new recorder err: %v", err)
+	}
+	rec.Resize(120, 40)
+	rec.Input([]byte("ls\r"))
+	rec.Output([]byte("bin  etc\r\n"))
+	if err := rec.Close(); err != nil {
+		t.Fatalf("close err: %v", err)
+	}
+
+	if stat, err := sink.Stat("abc"); err != nil || stat.Namespace != "default" || stat.Pod != "nginx" {
+		t.Fatalf("unexpected stat %+v, err: %v", stat, err)
+	}
+	if _, err := sink.Stat("missing"); err != recorder.ErrNotFound {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	f, err := os.Open(filepath.Join(dir, "default", "nginx", "nginx", "abc.cast"))
+	if err != nil {
+		t.Fatalf("open recording err: %v", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Scan()
+	var header recorder.Header
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		t.Fatalf("decode header err: %v", err)
+	}
+	if header.Version != 2 || header.Session == nil || header.Session.SessionID != "abc" {
+		t.Fatalf("unexpected header: %+v", header)
+	}
+	want := []recorder.Event{
+		{Code: recorder.EventResize, Data: "120x40"},
+		{Code: recorder.EventInput, Data: "ls\r"},
+		{Code: recorder.EventOutput, Data: "bin  etc\r\n"},
+	}
+	for i := 0; scanner.Scan(); i++ {
+		var e recorder.Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("decode event err: %v", err)
+		}
+		if i >= len(want) || e.Code != want[i].Code || e.Data != want[i].Data {
+			t.Fatalf("unexpected event %d: %+v", i, e)
+		}
+	}
+}
+
+func TestDirSinkInvalidPath(t *testing.T) {
+	sink := recorder.NewDirSink(t.TempDir())
+	_, err := sink.Create(recorder.Meta{SessionID: "abc", Namespace: "..", Pod: "p", Container: "c"})
+	if err == nil {
+		t.Fatalf("expected error for invalid path")
+	}
+}
+
+const testRecording = `{"version": 2, "width": 80, "height": 24}
+[0.01, "o", "hello "]
+[0.02, "i", "ls\r"]
+[0.03, "r", "100x30"]
+[5.0, "o", "world"]
+`
+
+func TestPlayerSeek(t *testing.T) {
+	player, err := recorder.NewPlayer(strings.NewReader(testRecording))
+	if err != nil {
+		t.Fatalf("new player err: %v", err)
+	}
+	if player.Duration() != 5*time.Second {
+		t.Fatalf("unexpected duration %v", player.Duration())
+	}
+	ctl := make(chan recorder.Control, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	var got []recorder.Event
+	err = player.Play(ctx, ctl, func(e recorder.Event) error {
+		got = append(got, e)
+		if len(got) == 2 {
+			// skip the long pause before "world".
+			ctl <- recorder.Control{Operation: recorder.ControlSeek, Value: 10}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("play err: %v", err)
+	}
+	want := []string{"hello ", "100x30", "world"}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected events: %+v", got)
+	}
+	for i := range want {
+		if got[i].Data != want[i] {
+			t.Fatalf("unexpected event %d: %+v", i, got[i])
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package recorder
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// recording file extension
+const fileExt = ".cast"
+
+// Sink creates the destination of a recording.
+type Sink interface {
+	Create(meta Meta) (io.WriteCloser, error)
+}
+
+// ErrNotFound recording not found
+var ErrNotFound = errors.New("recording not found")
+
+// Filter selects recordings, zero value fields match all.
+type Filter struct {
+	Namespace string
+	Pod       string
+	User      string
+	Since     time.Time
+	Until     time.Time
+}
+
+// Match check if meta matches the filter.
+func (f *Filter) Match(meta *Meta) bool {
+	if f.Namespace != "" && f.Namespace != meta.Namespace {
+		return false
+	}
+	if f.Pod != "" && f.Pod != meta.Pod {
+		return false
+	}
+	if f.User != "" && f.User != meta.User {
+		return false
+	}
+	if !f.Since.IsZero() && meta.StartTime.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && meta.StartTime.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// Store is a Sink which recordings could be read back from.
+type Store interface {
+	Sink
+	// List list recordings matching filter, latest first.
+	List(filter Filter) ([]Meta, error)
+	// Open open recording with session id.
+	Open(id string) (io.ReadCloser, error)
+	// Stat get meta of recording with session id.
+	Stat(id string) (*Meta, error)
+}
+
+// DirSink stores recordings in a local directory,
+// as {Dir}/{namespace}/{pod}/{container}/{session-id}.cast
+type DirSink struct {
+	Dir string
+}
+
+// NewDirSink create DirSink
+func NewDirSink(dir string) *DirSink {
+	return &DirSink{Dir: dir}
+}
+
+// Create create recording file for meta.
+func (s *DirSink) Create(meta Meta) (io.WriteCloser, error) {
+	path, err := s.path(meta)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0640)
+}
+
+// List list recordings matching filter, latest first.
+func (s *DirSink) List(filter Filter) ([]Meta, error) {
+	root := s.Dir
+	if filter.Namespace != "" {
+		if err := validPathElem(filter.Namespace); err != nil {
+			return nil, err
+		}
+		root = filepath.Join(root, filter.Namespace)
+		if filter.Pod != "" {
+			if err := validPathElem(filter.Pod); err != nil {
+				return nil, err
+			}
+			root = filepath.Join(root, filter.Pod)
+		}
+	}
+	metas := []Meta{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != fileExt {
+			return nil
+		}
+		header, err := readHeader(path)
+		if err != nil {
+			// skip broken recordings instead of failing the whole list.
+			log.Printf("read recording %s err: %v", path, err)
+			return nil
+		}
+		if header.Session != nil && filter.Match(header.Session) {
+			metas = append(metas, *header.Session)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(metas, func(i, j int) bool {
+		return metas[i].StartTime.After(metas[j].StartTime)
+	})
+	return metas, nil
+}
+
+// Open open recording with session id.
+func (s *DirSink) Open(id string) (io.ReadCloser, error) {
+	path, err := s.find(id)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// Stat get meta of recording with session id.
+func (s *DirSink) Stat(id string) (*Meta, error) {
+	path, err := s.find(id)
+	if err != nil {
+		return nil, err
+	}
+	header, err := readHeader(path)
+	if err != nil {
+		return nil, err
+	}
+	if header.Session == nil {
+		return nil, fmt.Errorf("recording %s has no session meta", id)
+	}
+	return header.Session, nil
+}
+
+// find find path of recording with session id.
+func (s *DirSink) find(id string) (string, error) {
+	if err := validPathElem(id); err != nil {
+		return "", err
+	}
+	var found string
+	err := filepath.WalkDir(s.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && d.Name() == id+fileExt {
+			found = path
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	if found == "" {
+		return "", ErrNotFound
+	}
+	return found, nil
+}
+
+func readHeader(path string) (*Header, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	var header Header
+	if err := json.Unmarshal(line, &header); err != nil {
+		return nil, err
+	}
+	return &header, nil
+}
+
+func (s *DirSink) path(meta Meta) (string, error) {
+	elems := []string{meta.Namespace, meta.Pod, meta.Container, meta.SessionID}
+	for _, e := range elems {
+		if err := validPathElem(e); err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(s.Dir, filepath.Join(elems...)+fileExt), nil
+}
+
+// validPathElem make sure elem could not escape from sink directory.
+func validPathElem(elem string) error {
+	if elem == "" || elem == "." || elem == ".." || strings.ContainsAny(elem, `/\`) {
+		return fmt.Errorf("invalid recording path element '%s'", elem)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package terminal
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Session is a live terminal session tracked by Registry.
+type Session interface {
+	PtyHandler
+	ID() string
+	// Close end the session and the remote stream.
+	Close() error
+}
+
+// SessionInfo describes a live terminal session.
+type SessionInfo struct {
+	ID         string    `json:"id"`
+	User       string    `json:"user,omitempty"`
+	Namespace  string    `json:"namespace,omitempty"`
+	Pod        string    `json:"pod,omitempty"`
+	Container  string    `json:"container,omitempty"`
+	Node       string    `json:"node,omitempty"`
+	RemoteAddr string    `json:"remoteAddr,omitempty"`
+	StartTime  time.Time `json:"startTime"`
+	BytesIn    int64     `json:"bytesIn"`
+	BytesOut   int64     `json:"bytesOut"`
+}
+
+// SessionStats counts bytes of a registered session, updated by the session itself.
+type SessionStats struct {
+	in  atomic.Int64
+	out atomic.Int64
+}
+
+// Input count n bytes read from client.
+func (s *SessionStats) Input(n int) {
+	s.in.Add(int64(n))
+}
+
+// Output count n bytes written to client.
+func (s *SessionStats) Output(n int) {
+	s.out.Add(int64(n))
+}
+
+type registryEntry struct {
+	session Session
+	info    SessionInfo
+	stats   *SessionStats
+}
+
+// Registry tracks live terminal sessions. It is safe for concurrent use.
+type Registry struct {
+	mu      sync.RWMutex
+	entries map[string]*registryEntry
+}
+
+// DefaultRegistry registry of sessions served by this process.
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry create an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{entries: map[string]*registryEntry{}}
+}
+
+// Register track s until Unregister, return stats for s to count its bytes.
+// info.ID is set to s.ID().
+func (r *Registry) Register(s Session, info SessionInfo) *SessionStats {
+	info.ID = s.ID()
+	if info.StartTime.IsZero() {
+		info.StartTime = time.Now()
+	}
+	e := &registryEntry{session: s, info: info, stats: &SessionStats{}}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[info.ID] = e
+	return e.stats
+}
+
+// Unregister stop tracking session with id.
+func (r *Registry) Unregister(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.entries, id)
+}
+
+// Update update info of session with id by fn, e.g. set the target once it is known.
+func (r *Registry) Update(id string, fn func(info *SessionInfo)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e, ok := r.entries[id]; ok {
+		fn(&e.info)
+		e.info.ID = id
+	}
+}
+
+// Get find live session by id.
+func (r *Registry) Get(id string) (Session, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.entries[id]
+	if !ok {
+		return nil, false
+	}
+	return e.session, true
+}
+
+// Info return info of live session with id.
+func (r *Registry) Info(id string) (SessionInfo, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.entries[id]
+	if !ok {
+		return SessionInfo{}, false
+	}
+	return e.snapshot(), true
+}
+
+// List return info of all live sessions, oldest first.
+func (r *Registry) List() []SessionInfo {
+	r.mu.RLock()
+	infos := make([]SessionInfo, 0, len(r.entries))
+	for _, e := range r.entries {
+		infos = append(infos, e.snapshot())
+	}
+	r.mu.RUnlock()
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].StartTime.Before(infos[j].StartTime)
+	})
+	return infos
+}
+
+// Close force close session with id, ending its remote stream.
+func (r *Registry) Close(id string) error {
+	s, ok := r.Get(id)
+	if !ok {
+		return fmt.Errorf("session %s not found", id)
+	}
+	return s.Close()
+}
+
+func (e *registryEntry) snapshot() SessionInfo {
+	info := e.info
+	info.BytesIn = e.stats.in.Load()
+	info.BytesOut = e.stats.out.Load()
+	return info
+}
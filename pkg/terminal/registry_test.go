@@ -0,0 +1,54 @@
+package terminal_test
+
+import (
+	"io"
+	"testing"
+
+	"k8s.io/client-go/tools/remotecommand"
+
+	"github.com/maoqide/kubeutil/pkg/terminal"
+)
+
+type fakeSession struct {
+	id     string
+	closed bool
+}
+
+func (s *fakeSession) Next() *remotecommand.TerminalSize { return nil }
+func (s *fakeSession) Tty() bool                         { return true }
+func (s *fakeSession) Stdin() io.Reader                  { return nil }
+func (s *fakeSession) Stdout() io.Writer                 { return io.Discard }
+func (s *fakeSession) Stderr() io.Writer                 { return nil }
+func (s *fakeSession) ID() string                        { return s.id }
+func (s *fakeSession) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestRegistry(t *testing.T) {
+	r := terminal.NewRegistry()
+	s := &fakeSession{id: "a"}
+	stats := r.Register(s, terminal.SessionInfo{RemoteAddr: "10.0.0.1:1234"})
+	r.Update("a", func(info *terminal.SessionInfo) {
+		info.Namespace = "default"
+		info.Pod = "nginx"
+	})
+	stats.Input(3)
+	stats.Output(5)
+
+	infos := r.List()
+	if len(infos) != 1 {
+		t.Fatalf("unexpected sessions: %+v", infos)
+	}
+	info := infos[0]
+	if info.ID != "a" || info.Pod != "nginx" || info.RemoteAddr != "10.0.0.1:1234" || info.BytesIn != 3 || info.BytesOut != 5 {
+		t.Fatalf("unexpected session info: %+v", info)
+	}
+	if err := r.Close("a"); err != nil || !s.closed {
+		t.Fatalf("close session err: %v, closed: %v", err, s.closed)
+	}
+	r.Unregister("a")
+	if err := r.Close("a"); err == nil {
+		t.Fatal("expected error closing unregistered session")
+	}
+}
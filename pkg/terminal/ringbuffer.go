@@ -0,0 +1,84 @@
+package terminal
+
+import "sync"
+
+// RingBuffer keeps the last bytes written to it, up to its size.
+// It is safe for concurrent use.
+type RingBuffer struct {
+	mu   sync.Mutex
+	buf  []byte
+	size int
+	// next write position in buf
+	pos int
+	// total bytes ever written
+	written int64
+}
+
+// NewRingBuffer create RingBuffer holds up to size bytes.
+func NewRingBuffer(size int) *RingBuffer {
+	return &RingBuffer{
+		buf:  make([]byte, size),
+		size: size,
+	}
+}
+
+// Write write p into buffer, overwriting the oldest bytes when full. never fails.
+func (b *RingBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := len(p)
+	b.written += int64(n)
+	if n >= b.size {
+		copy(b.buf, p[n-b.size:])
+		b.pos = 0
+		return n, nil
+	}
+	c := copy(b.buf[b.pos:], p)
+	if c < n {
+		copy(b.buf, p[c:])
+	}
+	b.pos = (b.pos + n) % b.size
+	return n, nil
+}
+
+// Bytes return a copy of buffered bytes, oldest first.
+func (b *RingBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.bytes()
+}
+
+func (b *RingBuffer) bytes() []byte {
+	if b.written < int64(b.size) {
+		return append([]byte(nil), b.buf[:b.pos]...)
+	}
+	out := make([]byte, 0, b.size)
+	out = append(out, b.buf[b.pos:]...)
+	return append(out, b.buf[:b.pos]...)
+}
+
+// Written return total bytes ever written to buffer.
+func (b *RingBuffer) Written() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.written
+}
+
+// Since return buffered bytes written after offset, offset counts from the first byte ever written.
+// lost is the number of bytes after offset which have been overwritten already.
+func (b *RingBuffer) Since(offset int64) (p []byte, lost int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= b.written {
+		return nil, 0
+	}
+	buf := b.bytes()
+	start := b.written - int64(len(buf))
+	if offset < start {
+		return buf, start - offset
+	}
+	return buf[offset-start:], 0
+}
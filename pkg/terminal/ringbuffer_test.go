@@ -0,0 +1,40 @@
+package terminal_test
+
+import (
+	"testing"
+
+	"github.com/maoqide/kubeutil/pkg/terminal"
+)
+
+func TestRingBuffer(t *testing.T) {
+	b := terminal.NewRingBuffer(8)
+	b.Write([]byte("hello"))
+	if got := string(b.Bytes()); got != "hello" {
+		t.Fatalf("unexpected bytes: %q", got)
+	}
+	b.Write([]byte(" world"))
+	if got := string(b.Bytes()); got != "lo world" {
+		t.Fatalf("unexpected bytes: %q", got)
+	}
+	b.Write([]byte("0123456789"))
+	if got := string(b.Bytes()); got != "23456789" {
+		t.Fatalf("unexpected bytes: %q", got)
+	}
+	if b.Written() != 21 {
+		t.Fatalf("unexpected written: %d", b.Written())
+	}
+}
+
+func TestRingBufferSince(t *testing.T) {
+	b := terminal.NewRingBuffer(8)
+	b.Write([]byte("hello world"))
+	if p, lost := b.Since(5); string(p) != " world" || lost != 0 {
+		t.Fatalf("unexpected since 5: %q, lost %d", p, lost)
+	}
+	if p, lost := b.Since(1); string(p) != "lo world" || lost != 2 {
+		t.Fatalf("unexpected since 1: %q, lost %d", p, lost)
+	}
+	if p, lost := b.Since(11); len(p) != 0 || lost != 0 {
+		t.Fatalf("unexpected since 11: %q, lost %d", p, lost)
+	}
+}
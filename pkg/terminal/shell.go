@@ -0,0 +1,70 @@
+package terminal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultShells shells probed in order when no shell list is configured.
+const DefaultShells = "bash,sh,ash,busybox sh"
+
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ParseShells parse comma separated shell list, e.g. "bash,sh,busybox sh".
+func ParseShells(s string) [][]string {
+	shells := [][]string{}
+	for _, item := range strings.Split(s, ",") {
+		if words := strings.Fields(item); len(words) > 0 {
+			shells = append(shells, words)
+		}
+	}
+	return shells
+}
+
+// PreferShell move shell named preferred to the front of shells, preferred must be one of shells.
+func PreferShell(shells [][]string, preferred string) ([][]string, error) {
+	if preferred == "" {
+		return shells, nil
+	}
+	for i, shell := range shells {
+		if strings.Join(shell, " ") == preferred {
+			ordered := append([][]string{shell}, shells[:i]...)
+			return append(ordered, shells[i+1:]...), nil
+		}
+	}
+	return nil, fmt.Errorf("shell '%s' is not allowed", preferred)
+}
+
+// ProbeCommand return command which succeeds only if shell could be executed.
+func ProbeCommand(shell []string) []string {
+	return append(append([]string{}, shell...), "-c", "exit 0")
+}
+
+// ShellCommand return command starting shell with env exported, e.g.
+// ["bash", "-c", "export TERM='xterm'; exec 'bash'"].
+// env is set by the shell itself so that no extra binary like env is required in container.
+func ShellCommand(shell []string, env []string) []string {
+	if len(env) == 0 {
+		return shell
+	}
+	var script strings.Builder
+	script.WriteString("export")
+	for _, e := range env {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) != 2 || !envName.MatchString(kv[0]) {
+			continue
+		}
+		script.WriteString(" " + kv[0] + "=" + quote(kv[1]))
+	}
+	script.WriteString("; exec")
+	for _, word := range shell {
+		script.WriteString(" " + quote(word))
+	}
+	return append(append([]string{}, shell...), "-c", script.String())
+}
+
+// quote single quote s for posix shell.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
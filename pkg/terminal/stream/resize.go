@@ -0,0 +1,41 @@
+package stream
+
+import (
+	"golang.org/x/term"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// monitorSize push size of local terminal fd into resizeChan, first the initial size
+// then every change of it, until session done.
+func (t *TerminalSession) monitorSize(fd int) {
+	changes, stop := notifySizeChanges()
+	defer stop()
+	var last remotecommand.TerminalSize
+	for {
+		width, height, err := term.GetSize(fd)
+		if err == nil && width > 0 && height > 0 {
+			size := remotecommand.TerminalSize{Width: uint16(width), Height: uint16(height)}
+			if size != last {
+				select {
+				case t.resizeChan <- size:
+					last = size
+				case <-t.doneChan:
+					return
+				}
+			}
+		}
+		select {
+		case <-changes:
+		case <-t.doneChan:
+			return
+		}
+	}
+}
+
+// notify send to ch without blocking, pending notification is enough.
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
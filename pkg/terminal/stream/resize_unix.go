@@ -0,0 +1,32 @@
+//go:build !windows
+
+package stream
+
+import (
+	"os"
+	"os/signal"
+
+	"golang.org/x/sys/unix"
+)
+
+// notifySizeChanges notify on SIGWINCH, call stop to stop notifying.
+func notifySizeChanges() (changes <-chan struct{}, stop func()) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, unix.SIGWINCH)
+	ch := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-sigs:
+				notify(ch)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return ch, func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
@@ -0,0 +1,31 @@
+//go:build windows
+
+package stream
+
+import (
+	"time"
+)
+
+// there is no SIGWINCH on windows, poll the size like kubectl does.
+const sizePollInterval = 250 * time.Millisecond
+
+// notifySizeChanges notify periodically, call stop to stop notifying.
+func notifySizeChanges() (changes <-chan struct{}, stop func()) {
+	ch := make(chan struct{}, 1)
+	ticker := time.NewTicker(sizePollInterval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				notify(ch)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return ch, func() {
+		ticker.Stop()
+		close(done)
+	}
+}
@@ -1,14 +1,17 @@
 package stream
 
 import (
+	"fmt"
 	"io"
+	"os"
+	"sync"
 
+	"golang.org/x/term"
 	"k8s.io/client-go/tools/remotecommand"
 )
 
-// standard implementation in /k8s.io/kubectl/pkg/util/term/resize.go
-// here is an incomplete implementation
-// sizeQueue implements remotecommand.TerminalSizeQueue
+// sizeQueue implements remotecommand.TerminalSizeQueue, fed by monitorSize in tty mode,
+// like /k8s.io/kubectl/pkg/util/term/resize.go
 type sizeQueue struct {
 	// resizeChan receives a Size each time the user's terminal is resized.
 	resizeChan chan remotecommand.TerminalSize
@@ -44,11 +47,21 @@ type TerminalSession struct {
 	IOStreams
 	sizeQueue
 	tty bool
+	// local terminal in raw mode and its state to restore, tty mode only
+	term     *os.File
+	oldState *term.State
+	doneOnce sync.Once
 }
 
 // Done done, must call Done() before connection close, or Next() would not exits.
+// local terminal is restored in tty mode.
 func (t *TerminalSession) Done() {
-	close(t.doneChan)
+	t.doneOnce.Do(func() {
+		close(t.doneChan)
+		if t.oldState != nil {
+			term.Restore(int(t.term.Fd()), t.oldState)
+		}
+	})
 }
 
 // Tty ...
@@ -67,11 +80,41 @@ func (t *TerminalSession) Stdout() io.Writer {
 }
 
 // Stderr ...
+// stderr is merged into stdout by remote tty in tty mode.
 func (t *TerminalSession) Stderr() io.Writer {
+	if t.tty {
+		return nil
+	}
 	return t.IOStreams.ErrOut
 }
 
-// NewTerminalSession create TerminalSession
+// NewTTYTerminalSession create TerminalSession in tty mode with local terminal tty, e.g. os.Stdin.
+// tty is put into raw mode until Done, and its size changes are sent to remote.
+// stream.In and stream.Out are tty if nil.
+func NewTTYTerminalSession(stream IOStreams, tty *os.File) (*TerminalSession, error) {
+	fd := int(tty.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("%s is not a terminal", tty.Name())
+	}
+	if stream.In == nil {
+		stream.In = tty
+	}
+	if stream.Out == nil {
+		stream.Out = tty
+	}
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+	t := NewTerminalSession(stream)
+	t.tty = true
+	t.term = tty
+	t.oldState = oldState
+	go t.monitorSize(fd)
+	return t, nil
+}
+
+// NewTerminalSession create TerminalSession without tty, see NewTTYTerminalSession for tty mode.
 func NewTerminalSession(stream IOStreams) *TerminalSession {
 	return &TerminalSession{
 		IOStreams: stream,
@@ -29,3 +29,14 @@ func TestExec(t *testing.T) {
 		t.Fatalf("%+v", err)
 	}
 }
+
+func TestNewTTYTerminalSessionNotTerminal(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "tty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := stream.NewTTYTerminalSession(stream.IOStreams{}, f); err == nil {
+		t.Fatal("expected error for non terminal file")
+	}
+}
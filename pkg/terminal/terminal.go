@@ -1,12 +1,14 @@
 package terminal
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/util/exec"
 )
 
 const (
@@ -27,6 +29,10 @@ const (
 
 	// EndOfTransmission end
 	EndOfTransmission = "\u0004"
+
+	// ExitCodeError exit code reported when the session ends without the remote process
+	// exit status, e.g. api error or broken stream.
+	ExitCodeError = -1
 )
 
 // PtyHandler is what remotecommand expects from a pty
@@ -39,12 +45,35 @@ type PtyHandler interface {
 	Stderr() io.Writer
 }
 
+// InputFilter inspects stdin of a terminal session before it reaches the remote process.
+type InputFilter interface {
+	// Filter return input to pass on and reply to show to the user, either could be empty.
+	Filter(p []byte) (pass []byte, reply []byte)
+}
+
 // TerminalMessage is the messaging protocol between ShellController and TerminalSession.
+// For operation exit, Code is the exit code and Data the reason.
+// For operation warning, Remaining is the seconds left before the session is closed.
 type TerminalMessage struct {
 	Operation string `json:"operation"`
 	Data      string `json:"data"`
 	Rows      uint16 `json:"rows"`
 	Cols      uint16 `json:"cols"`
+	Code      int    `json:"code"`
+	Remaining int    `json:"remaining,omitempty"`
+}
+
+// ExitStatus return exit code and reason of the error returned by stream,
+// ExitCodeError if err is not caused by the remote process exit.
+func ExitStatus(err error) (int, string) {
+	if err == nil {
+		return 0, "exited"
+	}
+	var exitErr exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.Exited() {
+		return exitErr.ExitStatus(), fmt.Sprintf("exited with code %d", exitErr.ExitStatus())
+	}
+	return ExitCodeError, err.Error()
 }
 
 // ValidatePod validate pod.
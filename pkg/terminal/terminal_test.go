@@ -1,8 +1,50 @@
 package terminal_test
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
+
+	"k8s.io/client-go/util/exec"
+
+	"github.com/maoqide/kubeutil/pkg/terminal"
 )
 
 func TestExecPod(t *testing.T) {
 }
+
+func TestExitStatus(t *testing.T) {
+	cases := []struct {
+		err  error
+		code int
+	}{
+		{nil, 0},
+		{exec.CodeExitError{Err: errors.New("command terminated with exit code 2"), Code: 2}, 2},
+		{fmt.Errorf("stream: %w", exec.CodeExitError{Err: errors.New("exit 137"), Code: 137}), 137},
+		{errors.New("pods \"nginx\" is forbidden"), terminal.ExitCodeError},
+	}
+	for _, c := range cases {
+		if code, reason := terminal.ExitStatus(c.err); code != c.code {
+			t.Errorf("ExitStatus(%v) = %d, %s, want code %d", c.err, code, reason, c.code)
+		}
+	}
+}
+
+func TestShellCommand(t *testing.T) {
+	shells, err := terminal.PreferShell(terminal.ParseShells(terminal.DefaultShells), "busybox sh")
+	if err != nil {
+		t.Fatalf("prefer shell err: %v", err)
+	}
+	if len(shells) != 4 || strings.Join(shells[0], " ") != "busybox sh" || shells[1][0] != "bash" {
+		t.Fatalf("unexpected shells: %v", shells)
+	}
+	if _, err := terminal.PreferShell(shells, "python"); err == nil {
+		t.Fatalf("expected error for shell not in list")
+	}
+	cmd := terminal.ShellCommand(shells[0], []string{"TERM=xterm", "LANG=it's", "BAD;NAME=x"})
+	want := []string{"busybox", "sh", "-c", `export TERM='xterm' LANG='it'\''s'; exec 'busybox' 'sh'`}
+	if strings.Join(cmd, "|") != strings.Join(want, "|") {
+		t.Fatalf("unexpected command: %q", cmd)
+	}
+}
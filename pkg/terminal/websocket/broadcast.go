@@ -0,0 +1,91 @@
+package websocket
+
+import (
+	"sync"
+
+	"github.com/maoqide/kubeutil/pkg/terminal"
+)
+
+const (
+	// output kept for the initial screen of new watchers.
+	screenBufferSize = 64 * 1024
+
+	// messages queued for a watcher before it is considered too slow and dropped.
+	watcherQueueSize = 256
+)
+
+// broadcaster fans out session messages to watchers.
+type broadcaster struct {
+	mu     sync.Mutex
+	screen *terminal.RingBuffer
+	subs   map[string]chan terminal.TerminalMessage
+	closed bool
+}
+
+func newBroadcaster() *broadcaster {
+	return &broadcaster{
+		screen: terminal.NewRingBuffer(screenBufferSize),
+		subs:   make(map[string]chan terminal.TerminalMessage),
+	}
+}
+
+// publish send msg to all watchers, output is also kept in screen buffer.
+// watchers which could not keep up are dropped.
+func (b *broadcaster) publish(msg terminal.TerminalMessage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	if msg.Operation == "stdout" || msg.Operation == "stderr" {
+		b.screen.Write([]byte(msg.Data))
+	}
+	for id, ch := range b.subs {
+		select {
+		case ch <- msg:
+		default:
+			delete(b.subs, id)
+			close(ch)
+		}
+	}
+}
+
+// subscribe add a watcher, return its message channel and current screen buffer.
+// the channel is closed when the watcher is dropped or the broadcaster closed.
+func (b *broadcaster) subscribe(id string) (<-chan terminal.TerminalMessage, []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan terminal.TerminalMessage, watcherQueueSize)
+	if b.closed {
+		close(ch)
+		return ch, nil
+	}
+	b.subs[id] = ch
+	return ch, b.screen.Bytes()
+}
+
+func (b *broadcaster) unsubscribe(id string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch, ok := b.subs[id]; ok {
+		delete(b.subs, id)
+		close(ch)
+	}
+}
+
+func (b *broadcaster) has(id string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.subs[id]
+	return ok
+}
+
+func (b *broadcaster) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for id, ch := range b.subs {
+		delete(b.subs, id)
+		close(ch)
+	}
+}
@@ -0,0 +1,125 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/maoqide/kubeutil/pkg/terminal"
+)
+
+const (
+	// JSONProtocol every message is a json encoded TerminalMessage in a text frame.
+	// It is used when client does not request any subprotocol.
+	JSONProtocol = "json.terminal.kubeutil.io"
+	// BinaryProtocol every message is a binary frame prefixed with one byte channel,
+	// in the style of channel.k8s.io.
+	BinaryProtocol = "binary.terminal.kubeutil.io"
+)
+
+// channels of BinaryProtocol
+const (
+	// StdinChannel raw stdin bytes, client to server.
+	StdinChannel byte = iota
+	// StdoutChannel raw stdout bytes, server to client.
+	StdoutChannel
+	// StderrChannel raw stderr bytes, server to client.
+	StderrChannel
+	// StatusChannel json encoded TerminalMessage with exit status, server to client.
+	StatusChannel
+	// ResizeChannel json encoded remotecommand.TerminalSize, client to server.
+	ResizeChannel
+
+	// ControlChannel json encoded TerminalMessage of any other operation, both directions.
+	ControlChannel byte = 255
+)
+
+// protocol encodes TerminalMessage to websocket frames and back.
+type protocol interface {
+	encode(msg terminal.TerminalMessage) (messageType int, data []byte, err error)
+	decode(messageType int, data []byte) (terminal.TerminalMessage, error)
+}
+
+// negotiated return protocol selected during websocket handshake.
+func negotiated(conn *websocket.Conn) protocol {
+	if conn.Subprotocol() == BinaryProtocol {
+		return binaryProtocol{}
+	}
+	return jsonProtocol{}
+}
+
+type jsonProtocol struct{}
+
+func (jsonProtocol) encode(msg terminal.TerminalMessage) (int, []byte, error) {
+	b, err := json.Marshal(msg)
+	return websocket.TextMessage, b, err
+}
+
+func (jsonProtocol) decode(_ int, data []byte) (terminal.TerminalMessage, error) {
+	var msg terminal.TerminalMessage
+	err := json.Unmarshal(data, &msg)
+	return msg, err
+}
+
+type binaryProtocol struct{}
+
+// resize payload, same as remotecommand.TerminalSize
+type terminalSize struct {
+	Width  uint16
+	Height uint16
+}
+
+func (binaryProtocol) encode(msg terminal.TerminalMessage) (int, []byte, error) {
+	var channel byte
+	switch msg.Operation {
+	case "stdout":
+		channel = StdoutChannel
+	case "stderr":
+		channel = StderrChannel
+	case "exit":
+		channel = StatusChannel
+	default:
+		channel = ControlChannel
+	}
+	if channel == StdoutChannel || channel == StderrChannel {
+		data := make([]byte, len(msg.Data)+1)
+		data[0] = channel
+		copy(data[1:], msg.Data)
+		return websocket.BinaryMessage, data, nil
+	}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return 0, nil, err
+	}
+	return websocket.BinaryMessage, append([]byte{channel}, b...), nil
+}
+
+func (binaryProtocol) decode(messageType int, data []byte) (terminal.TerminalMessage, error) {
+	var msg terminal.TerminalMessage
+	if messageType != websocket.BinaryMessage {
+		return msg, fmt.Errorf("unexpected non-binary message")
+	}
+	if len(data) == 0 {
+		return msg, fmt.Errorf("empty message")
+	}
+	switch data[0] {
+	case StdinChannel:
+		msg.Operation = "stdin"
+		msg.Data = string(data[1:])
+	case ResizeChannel:
+		var size terminalSize
+		if err := json.Unmarshal(data[1:], &size); err != nil {
+			return msg, err
+		}
+		msg.Operation = "resize"
+		msg.Cols, msg.Rows = size.Width, size.Height
+	case ControlChannel:
+		if err := json.Unmarshal(data[1:], &msg); err != nil {
+			return msg, err
+		}
+	default:
+		return msg, fmt.Errorf("unknown channel %d", data[0])
+	}
+	return msg, nil
+}
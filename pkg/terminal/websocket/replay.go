@@ -0,0 +1,103 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/maoqide/kubeutil/pkg/terminal"
+	"github.com/maoqide/kubeutil/pkg/terminal/recorder"
+)
+
+// Replay upgrade the connection and play the recording to it as stdout messages.
+// Client controls playback with TerminalMessage operations speed, seek, pause and resume,
+// the value of speed and seek is passed in Data, seek value prefixed with +/- is relative.
+func Replay(w http.ResponseWriter, r *http.Request, player *recorder.Player) error {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetReadLimit(maxMessageSize)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctl := make(chan recorder.Control)
+	proto := negotiated(conn)
+	go func() {
+		// stop playing when client goes away.
+		defer cancel()
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			msg, err := proto.decode(messageType, message)
+			if err != nil {
+				log.Printf("replay control err: %v", err)
+				continue
+			}
+			c, err := parseControl(msg)
+			if err != nil {
+				log.Printf("replay control err: %v", err)
+				continue
+			}
+			select {
+			case ctl <- c:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	send := func(msg terminal.TerminalMessage) error {
+		messageType, b, err := proto.encode(msg)
+		if err != nil {
+			return err
+		}
+		conn.SetWriteDeadline(time.Now().Add(writeWait))
+		return conn.WriteMessage(messageType, b)
+	}
+	header := player.Header()
+	if err := send(terminal.TerminalMessage{Operation: "resize", Cols: header.Width, Rows: header.Height}); err != nil {
+		return err
+	}
+	err = player.Play(ctx, ctl, func(e recorder.Event) error {
+		if e.Code == recorder.EventResize {
+			var cols, rows uint16
+			if _, err := fmt.Sscanf(e.Data, "%dx%d", &cols, &rows); err != nil {
+				return nil
+			}
+			return send(terminal.TerminalMessage{Operation: "resize", Cols: cols, Rows: rows})
+		}
+		return send(terminal.TerminalMessage{Operation: "stdout", Data: e.Data})
+	})
+	if err != nil {
+		return err
+	}
+	return conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, "end of recording"), time.Now().Add(writeWait))
+}
+
+func parseControl(msg terminal.TerminalMessage) (recorder.Control, error) {
+	c := recorder.Control{Operation: msg.Operation}
+	switch msg.Operation {
+	case recorder.ControlPause, recorder.ControlResume:
+	case recorder.ControlSpeed, recorder.ControlSeek:
+		c.Relative = strings.HasPrefix(msg.Data, "+") || strings.HasPrefix(msg.Data, "-")
+		v, err := strconv.ParseFloat(msg.Data, 64)
+		if err != nil {
+			return c, fmt.Errorf("invalid %s value '%s'", msg.Operation, msg.Data)
+		}
+		c.Value = v
+	default:
+		return c, fmt.Errorf("unknown message type '%s'", msg.Operation)
+	}
+	return c, nil
+}
@@ -0,0 +1,182 @@
+package websocket
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/maoqide/kubeutil/pkg/terminal"
+)
+
+// output kept for resuming clients.
+const resumeBufferSize = 256 * 1024
+
+var (
+	// ErrInvalidToken resume token does not match the session.
+	ErrInvalidToken = errors.New("invalid resume token")
+	// ErrSessionClosed session ended before resumed.
+	ErrSessionClosed = errors.New("session closed")
+
+	errDisconnected = errors.New("client disconnected")
+)
+
+// SetResumable keep the session running for grace after owner connection drops,
+// owner could Resume the session with the token sent in operation token meanwhile.
+// must be called before the session starts streaming.
+func (t *TerminalSession) SetResumable(grace time.Duration) {
+	if grace <= 0 {
+		return
+	}
+	t.mu.Lock()
+	t.resumeGrace = grace
+	t.mu.Unlock()
+	t.writeMu.Lock()
+	t.output = newOutputBuffer(resumeBufferSize)
+	t.writeMu.Unlock()
+	t.send(terminal.TerminalMessage{Operation: "token", Data: t.token})
+}
+
+// disconnected handle failure of owner connection conn.
+// session ends right away if not resumable or client closed the connection cleanly,
+// otherwise it waits for owner to resume.
+func (t *TerminalSession) disconnected(conn *websocket.Conn, err error) {
+	t.mu.Lock()
+	t.writeMu.Lock()
+	if t.conn != conn {
+		// replaced by resume or session closed.
+		t.writeMu.Unlock()
+		t.mu.Unlock()
+		return
+	}
+	t.conn.Close()
+	close(t.connDone)
+	t.conn, t.connDone = nil, nil
+	t.writeMu.Unlock()
+
+	// client with close handshake is gone on purpose, it would not resume.
+	closed := websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived)
+	if t.resumeGrace <= 0 || closed {
+		t.readErr = err
+		close(t.readDone)
+		t.mu.Unlock()
+		if closed {
+			t.end("client closed the session")
+		}
+		return
+	}
+	grace := t.resumeGrace
+	log.Printf("session %s disconnected, waiting %v for client to resume", t.id, grace)
+	t.detachTimer = time.AfterFunc(grace, func() {
+		t.end(fmt.Sprintf("client did not resume in %v", grace))
+	})
+	t.mu.Unlock()
+}
+
+// Resume reconnect owner to the session with token, replacing current owner connection if any.
+// output after offset, the number of stdout and stderr bytes client has received, is sent again.
+// Resume returns after the connection is upgraded, the session goes on with it.
+func (t *TerminalSession) Resume(w http.ResponseWriter, r *http.Request, token string, offset int64) error {
+	t.mu.Lock()
+	resumable := t.resumeGrace > 0
+	t.mu.Unlock()
+	if !resumable || subtle.ConstantTimeCompare([]byte(token), []byte(t.token)) != 1 {
+		http.Error(w, ErrInvalidToken.Error(), http.StatusForbidden)
+		return ErrInvalidToken
+	}
+	select {
+	case <-t.doneChan:
+		http.Error(w, ErrSessionClosed.Error(), http.StatusGone)
+		return ErrSessionClosed
+	default:
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.detachTimer != nil {
+		t.detachTimer.Stop()
+		t.detachTimer = nil
+	}
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	// session may have ended while upgrading.
+	select {
+	case <-t.doneChan:
+		conn.Close()
+		return ErrSessionClosed
+	default:
+	}
+	t.serve(conn)
+	log.Printf("session %s resumed from offset %d", t.id, offset)
+	t.sendLocked(terminal.TerminalMessage{Operation: "session", Data: t.id})
+	missed, lost := t.output.since(offset)
+	if lost > 0 {
+		t.sendLocked(terminal.TerminalMessage{Operation: "warning", Data: fmt.Sprintf("%d bytes of output lost", lost)})
+	}
+	for _, msg := range missed {
+		t.sendLocked(msg)
+	}
+	return nil
+}
+
+// outputBuffer keeps recent stdout and stderr with their operation for resuming clients.
+// It is guarded by writeMu of the session.
+type outputBuffer struct {
+	buf  *terminal.RingBuffer
+	size int64
+	// operation changes of output in buf, oldest first
+	segments []outputSegment
+}
+
+type outputSegment struct {
+	operation string
+	// offset of the first byte of the segment
+	start int64
+}
+
+func newOutputBuffer(size int) *outputBuffer {
+	return &outputBuffer{buf: terminal.NewRingBuffer(size), size: int64(size)}
+}
+
+func (b *outputBuffer) write(operation string, p []byte) {
+	written := b.buf.Written()
+	if n := len(b.segments); n == 0 || b.segments[n-1].operation != operation {
+		b.segments = append(b.segments, outputSegment{operation: operation, start: written})
+	}
+	b.buf.Write(p)
+	// drop segments overwritten entirely.
+	oldest := written + int64(len(p)) - b.size
+	for len(b.segments) > 1 && b.segments[1].start <= oldest {
+		b.segments = b.segments[1:]
+	}
+}
+
+// since return output after offset as messages of their operation, see RingBuffer.Since for lost.
+func (b *outputBuffer) since(offset int64) (msgs []terminal.TerminalMessage, lost int64) {
+	p, lost := b.buf.Since(offset)
+	end := b.buf.Written()
+	start := end - int64(len(p))
+	for i, s := range b.segments {
+		segEnd := end
+		if i+1 < len(b.segments) {
+			segEnd = b.segments[i+1].start
+		}
+		if segEnd <= start {
+			continue
+		}
+		from := s.start
+		if from < start {
+			from = start
+		}
+		msgs = append(msgs, terminal.TerminalMessage{Operation: s.operation, Data: string(p[from-start : segEnd-start])})
+	}
+	return msgs, lost
+}
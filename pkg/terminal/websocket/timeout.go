@@ -0,0 +1,102 @@
+package websocket
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/maoqide/kubeutil/pkg/terminal"
+)
+
+const (
+	// clients are warned this long before session is ended, at most.
+	maxTimeoutWarning = time.Minute
+
+	timeoutCheckPeriod = time.Second
+)
+
+// SetTimeouts end the session if no stdin received in idle, or when it lasts longer than maxDuration.
+// client is warned with operation warning before session ends, with the remaining seconds.
+// zero disables the corresponding timeout.
+// must be called at most once.
+func (t *TerminalSession) SetTimeouts(idle, maxDuration time.Duration) {
+	if idle <= 0 && maxDuration <= 0 {
+		return
+	}
+	go t.watchTimeouts(idle, maxDuration)
+}
+
+func (t *TerminalSession) watchTimeouts(idle, maxDuration time.Duration) {
+	ticker := time.NewTicker(timeoutCheckPeriod)
+	defer ticker.Stop()
+	var idleWarned, maxWarned bool
+	for {
+		select {
+		case <-t.doneChan:
+			return
+		case now := <-ticker.C:
+			if maxDuration > 0 {
+				remaining := t.startTime.Add(maxDuration).Sub(now)
+				if remaining <= 0 {
+					t.end(fmt.Sprintf("session exceeded maximum duration %v", maxDuration))
+					return
+				}
+				if !maxWarned && remaining <= timeoutWarning(maxDuration) {
+					maxWarned = true
+					t.warn(fmt.Sprintf("session reaches maximum duration %v", maxDuration), remaining)
+				}
+			}
+			if idle > 0 {
+				remaining := time.Unix(0, t.lastActive.Load()).Add(idle).Sub(now)
+				if remaining <= 0 {
+					t.end(fmt.Sprintf("session idle for %v", idle))
+					return
+				}
+				// warn again if client became active after last warning.
+				if remaining > timeoutWarning(idle) {
+					idleWarned = false
+				} else if !idleWarned {
+					idleWarned = true
+					t.warn(fmt.Sprintf("session idle, no input for %v", idle-remaining), remaining)
+				}
+			}
+		}
+	}
+}
+
+// warn tell owner and watchers the session ends in remaining.
+func (t *TerminalSession) warn(reason string, remaining time.Duration) {
+	seconds := int(remaining.Round(time.Second).Seconds())
+	msg := fmt.Sprintf("%s, will be closed in %ds", reason, seconds)
+	log.Printf("session %s: %s", t.id, msg)
+	t.notify(terminal.TerminalMessage{Operation: "warning", Data: msg, Remaining: seconds})
+}
+
+// end end the session with reason, terminating the remote stream.
+// empty reason means the session ends normally.
+func (t *TerminalSession) end(reason string) {
+	t.endOnce.Do(func() {
+		if reason != "" {
+			log.Printf("session %s ended: %s", t.id, reason)
+			t.mu.Lock()
+			t.endReason = reason
+			t.mu.Unlock()
+		}
+		t.cancel()
+		close(t.doneChan)
+	})
+}
+
+// EndReason return why the session was ended by server, empty if it was not.
+func (t *TerminalSession) EndReason() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.endReason
+}
+
+func timeoutWarning(d time.Duration) time.Duration {
+	if w := d / 4; w < maxTimeoutWarning {
+		return w
+	}
+	return maxTimeoutWarning
+}
@@ -0,0 +1,104 @@
+package websocket
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/maoqide/kubeutil/pkg/terminal"
+	"github.com/maoqide/kubeutil/utils"
+)
+
+// Lookup find live websocket session by id in terminal.DefaultRegistry.
+func Lookup(id string) (*TerminalSession, bool) {
+	s, ok := terminal.DefaultRegistry.Get(id)
+	if !ok {
+		return nil, false
+	}
+	t, ok := s.(*TerminalSession)
+	return t, ok
+}
+
+// Watch upgrade the connection as a read-only viewer of the session.
+// The viewer receives the buffered screen then the live output, its stdin is ignored
+// unless it has been handed control. Watch blocks until the viewer or the session goes away.
+func (t *TerminalSession) Watch(w http.ResponseWriter, r *http.Request) error {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go ping(conn, done)
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+
+	id := utils.NewID()[:8]
+	ch, screen := t.broadcaster.subscribe(id)
+	defer t.leave(id)
+	t.send(terminal.TerminalMessage{Operation: "watcher", Data: id})
+	proto := negotiated(conn)
+	go t.watcherReadLoop(id, conn, proto)
+
+	write := func(msg terminal.TerminalMessage) error {
+		messageType, b, err := proto.encode(msg)
+		if err != nil {
+			return err
+		}
+		conn.SetWriteDeadline(time.Now().Add(writeWait))
+		return conn.WriteMessage(messageType, b)
+	}
+	if err := write(terminal.TerminalMessage{Operation: "watcher", Data: id}); err != nil {
+		return err
+	}
+	if err := write(terminal.TerminalMessage{Operation: "stdout", Data: string(screen)}); err != nil {
+		return err
+	}
+	for msg := range ch {
+		if err := write(msg); err != nil {
+			return err
+		}
+	}
+	return conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, "session closed"), time.Now().Add(writeWait))
+}
+
+// watcherReadLoop read messages from watcher, stop watching on error.
+func (t *TerminalSession) watcherReadLoop(id string, conn *websocket.Conn, proto protocol) {
+	defer t.broadcaster.unsubscribe(id)
+	for {
+		messageType, message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		msg, err := proto.decode(messageType, message)
+		if err != nil {
+			log.Printf("watcher %s parse message err: %v", id, err)
+			continue
+		}
+		if msg.Operation == "stdin" || msg.Operation == "handoff" {
+			t.handleMessage(id, msg)
+		}
+	}
+}
+
+// leave give control back to owner if the leaving watcher holds it.
+func (t *TerminalSession) leave(id string) {
+	t.broadcaster.unsubscribe(id)
+	t.mu.Lock()
+	inControl := t.controller == id
+	if inControl {
+		t.controller = ""
+	}
+	t.mu.Unlock()
+	if inControl {
+		t.notify(terminal.TerminalMessage{Operation: "control", Data: ""})
+	}
+}
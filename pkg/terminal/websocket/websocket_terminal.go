@@ -1,17 +1,22 @@
 package websocket
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"k8s.io/client-go/tools/remotecommand"
 
+	"github.com/maoqide/kubeutil/pkg/redact"
 	"github.com/maoqide/kubeutil/pkg/terminal"
+	"github.com/maoqide/kubeutil/pkg/terminal/recorder"
+	"github.com/maoqide/kubeutil/utils"
 )
 
 const (
@@ -26,11 +31,15 @@ const (
 
 	// Send pings to peer with this period. Must be less than pongWait.
 	pingPeriod = (pongWait * 9) / 10
+
+	// Maximum length of close frame reason, control frame payload is limited to 125 bytes.
+	maxCloseReason = 123
 )
 
 var upgrader = func() websocket.Upgrader {
 	upgrader := websocket.Upgrader{}
 	upgrader.HandshakeTimeout = time.Second * 2
+	upgrader.Subprotocols = []string{BinaryProtocol, JSONProtocol}
 	upgrader.CheckOrigin = func(r *http.Request) bool {
 		return true
 	}
@@ -39,10 +48,58 @@ var upgrader = func() websocket.Upgrader {
 
 // TerminalSession implements PtyHandler
 type TerminalSession struct {
-	wsConn   *websocket.Conn
+	id string
+	// secret to resume the session, only known to owner
+	token    string
 	sizeChan chan remotecommand.TerminalSize
 	doneChan chan struct{}
 	tty      bool
+	recorder *recorder.Recorder
+	stats    *terminal.SessionStats
+	filter   terminal.InputFilter
+	// mask secrets in stdout and stderr, nil if not redacted
+	stdout, stderr *redact.Writer
+
+	// ctx is canceled when session ends, to terminate the remote stream
+	ctx       context.Context
+	cancel    context.CancelFunc
+	startTime time.Time
+	// unix nano of the last stdin from client in control
+	lastActive atomic.Int64
+	endOnce    sync.Once
+	endReason  string
+
+	// stdin accepted from the connection in control
+	stdinChan chan []byte
+	// stdin left over by the last Read
+	pending []byte
+	// closed when reading from owner connection failed, with readErr
+	readDone chan struct{}
+	readErr  error
+	// closed by Start, messages from client are read after it
+	started   chan struct{}
+	startOnce sync.Once
+
+	// serialize writes to owner connection, guards conn, protocol, connDone and output
+	writeMu sync.Mutex
+	// owner connection, nil while disconnected
+	conn     *websocket.Conn
+	protocol protocol
+	// closed when conn is dropped
+	connDone chan struct{}
+	// recent output to send again on resume, nil if not resumable
+	output      *outputBuffer
+	broadcaster *broadcaster
+
+	mu sync.Mutex
+	// id of the watcher in control of stdin, empty for the owner
+	controller   string
+	allowHandoff bool
+	exitReason   string
+	closeOnce    sync.Once
+	// how long to wait for owner to resume after disconnected, 0 if not resumable
+	resumeGrace time.Duration
+	detachTimer *time.Timer
 }
 
 // NewTerminalSession create TerminalSession
@@ -51,23 +108,95 @@ func NewTerminalSession(w http.ResponseWriter, r *http.Request, responseHeader h
 	if err != nil {
 		return nil, err
 	}
+	ctx, cancel := context.WithCancel(context.Background())
 	session := &TerminalSession{
-		wsConn:   conn,
-		tty:      true,
-		sizeChan: make(chan remotecommand.TerminalSize),
-		doneChan: make(chan struct{}),
+		id:          utils.NewID(),
+		token:       utils.NewID(),
+		ctx:         ctx,
+		cancel:      cancel,
+		startTime:   time.Now(),
+		tty:         true,
+		sizeChan:    make(chan remotecommand.TerminalSize),
+		doneChan:    make(chan struct{}),
+		stdinChan:   make(chan []byte),
+		readDone:    make(chan struct{}),
+		started:     make(chan struct{}),
+		broadcaster: newBroadcaster(),
 	}
-	go ping(conn, session.doneChan)
-	conn.SetReadLimit(maxMessageSize)
-	conn.SetReadDeadline(time.Now().Add(pongWait))
-	conn.SetWriteDeadline(time.Now().Add(writeWait))
-	conn.SetPongHandler(func(string) error {
-		conn.SetReadDeadline(time.Now().Add(pongWait))
-		return nil
+	session.lastActive.Store(session.startTime.UnixNano())
+	session.writeMu.Lock()
+	session.serve(conn)
+	session.writeMu.Unlock()
+	session.stats = terminal.DefaultRegistry.Register(session, terminal.SessionInfo{
+		RemoteAddr: r.RemoteAddr,
+		StartTime:  session.startTime,
 	})
+	// let client know the id to share with watchers.
+	session.send(terminal.TerminalMessage{Operation: "session", Data: session.id})
 	return session, nil
 }
 
+// Deny reject request with reason. websocket requests are upgraded then closed with policy violation,
+// so that browsers could see the reason, other requests get 403.
+func Deny(w http.ResponseWriter, r *http.Request, reason string) {
+	if !websocket.IsWebSocketUpgrade(r) {
+		http.Error(w, reason, http.StatusForbidden)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.ClosePolicyViolation, truncate(reason, maxCloseReason)), time.Now().Add(writeWait))
+}
+
+// ID return session id.
+func (t *TerminalSession) ID() string {
+	return t.id
+}
+
+// Context return context canceled when session ends,
+// remote stream should be started with it so that it is terminated with the session.
+func (t *TerminalSession) Context() context.Context {
+	return t.ctx
+}
+
+// SetRecorder record the session with rec, rec is closed when session closed.
+// must be called before Start.
+func (t *TerminalSession) SetRecorder(rec *recorder.Recorder) {
+	t.recorder = rec
+}
+
+// SetInputFilter filter stdin with f before passing it on to the remote process,
+// replies of f are sent to client as stderr. must be called before Start.
+func (t *TerminalSession) SetInputFilter(f terminal.InputFilter) {
+	t.filter = f
+}
+
+// SetRedactor mask secrets of r in output, before it is recorded or sent to owner and watchers.
+// must be called before Start.
+func (t *TerminalSession) SetRedactor(r *redact.Redactor) {
+	t.stdout = redact.NewWriter(t, r)
+	t.stderr = redact.NewWriter(stderrWriter{t}, r)
+}
+
+// Start start handling messages from client, e.g. stdin and resize, once the session is configured.
+// SetRecorder, SetInputFilter, SetRedactor and SetTty must not be called after it.
+func (t *TerminalSession) Start() {
+	t.startOnce.Do(func() {
+		close(t.started)
+	})
+}
+
+// AllowHandoff allow the client in control to hand stdin over to a watcher.
+func (t *TerminalSession) AllowHandoff(allow bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.allowHandoff = allow
+}
+
 // Next called in a loop from remotecommand as long as the process is running
 // doneChan is closed when the process exits, otherwise it may block
 func (t *TerminalSession) Next() *remotecommand.TerminalSize {
@@ -86,58 +215,262 @@ func (t *TerminalSession) Stdin() io.Reader {
 
 // Stdout ...
 func (t *TerminalSession) Stdout() io.Writer {
+	if t.stdout != nil {
+		return t.stdout
+	}
 	return t
 }
 
 // Stderr ...
 func (t *TerminalSession) Stderr() io.Writer {
-	return t
+	if t.stderr != nil {
+		return t.stderr
+	}
+	return stderrWriter{t}
+}
+
+// stderrWriter sends output as operation stderr
+type stderrWriter struct {
+	t *TerminalSession
+}
+
+func (w stderrWriter) Write(p []byte) (int, error) {
+	return w.t.write("stderr", p)
 }
 
 // Read called in a loop from remotecommand as long as the process is running
 func (t *TerminalSession) Read(p []byte) (int, error) {
-	_, message, err := t.wsConn.ReadMessage()
-	if err != nil {
-		log.Printf("read message err: %v", err)
-		return copy(p, terminal.EndOfTransmission), err
+	for len(t.pending) == 0 {
+		select {
+		case data := <-t.stdinChan:
+			if t.filter != nil {
+				var reply []byte
+				data, reply = t.filter.Filter(data)
+				if len(reply) > 0 {
+					t.write("stderr", reply)
+				}
+			}
+			t.pending = data
+		case <-t.readDone:
+			return copy(p, terminal.EndOfTransmission), t.readErr
+		case <-t.doneChan:
+			return copy(p, terminal.EndOfTransmission), io.EOF
+		}
+	}
+	n := copy(p, t.pending)
+	t.pending = t.pending[n:]
+	t.stats.Input(n)
+	if t.recorder != nil {
+		t.recorder.Input(p[:n])
 	}
-	var msg terminal.TerminalMessage
-	if err := json.Unmarshal([]byte(message), &msg); err != nil {
-		log.Printf("read parse message err: %v", err)
-		// return 0, nil
-		return copy(p, terminal.EndOfTransmission), err
+	return n, nil
+}
+
+// serve start serving conn as owner connection, replacing the current one.
+// must be called with writeMu held.
+func (t *TerminalSession) serve(conn *websocket.Conn) {
+	if t.conn != nil {
+		t.dropConn("session resumed by another connection")
+	}
+	done := make(chan struct{})
+	t.conn, t.protocol, t.connDone = conn, negotiated(conn), done
+	go ping(conn, done)
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetWriteDeadline(time.Now().Add(writeWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+	go t.readLoop(conn, t.protocol)
+}
+
+// dropConn close owner connection with reason, must be called with writeMu held.
+func (t *TerminalSession) dropConn(reason string) error {
+	t.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, truncate(reason, maxCloseReason)), time.Now().Add(writeWait))
+	err := t.conn.Close()
+	close(t.connDone)
+	t.conn, t.connDone = nil, nil
+	return err
+}
+
+// readLoop read messages from owner connection until it fails.
+func (t *TerminalSession) readLoop(conn *websocket.Conn, proto protocol) {
+	select {
+	case <-t.started:
+	case <-t.doneChan:
+		return
+	}
+	// deadline may have passed while waiting for Start.
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	for {
+		messageType, message, err := conn.ReadMessage()
+		if err != nil {
+			log.Printf("read message err: %v", err)
+			t.disconnected(conn, err)
+			return
+		}
+		msg, err := proto.decode(messageType, message)
+		if err != nil {
+			log.Printf("read parse message err: %v", err)
+			t.disconnected(conn, err)
+			return
+		}
+		if err := t.handleMessage("", msg); err != nil {
+			log.Printf("handle message err: %v", err)
+			t.disconnected(conn, err)
+			return
+		}
 	}
+}
+
+// handleMessage handle message from owner connection or watcher with id.
+func (t *TerminalSession) handleMessage(from string, msg terminal.TerminalMessage) error {
 	switch msg.Operation {
 	case "stdin":
-		return copy(p, msg.Data), nil
+		if !t.inControl(from) {
+			return nil
+		}
+		t.lastActive.Store(time.Now().UnixNano())
+		select {
+		case t.stdinChan <- []byte(msg.Data):
+		case <-t.doneChan:
+		}
+		return nil
 	case "resize":
-		t.sizeChan <- remotecommand.TerminalSize{Width: msg.Cols, Height: msg.Rows}
-		return 0, nil
+		if !t.inControl(from) {
+			return nil
+		}
+		if t.recorder != nil {
+			t.recorder.Resize(msg.Cols, msg.Rows)
+		}
+		// without tty remotecommand does not call Next, resize would block stdin.
+		if !t.tty {
+			return nil
+		}
+		select {
+		case t.sizeChan <- remotecommand.TerminalSize{Width: msg.Cols, Height: msg.Rows}:
+		case <-t.doneChan:
+		}
+		return nil
+	case "handoff":
+		t.handoff(from, msg.Data)
+		return nil
+	case "close":
+		// owner ends the session explicitly, without waiting for it to resume.
+		if from == "" {
+			t.end("client closed the session")
+		}
+		return nil
 	case "ping":
-		return 0, nil
+		return nil
 	default:
 		log.Printf("unknown message type '%s'", msg.Operation)
-		// return 0, nil
-		return copy(p, terminal.EndOfTransmission), fmt.Errorf("unknown message type '%s'", msg.Operation)
+		return fmt.Errorf("unknown message type '%s'", msg.Operation)
 	}
 }
 
+func (t *TerminalSession) inControl(from string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.controller == from
+}
+
+// handoff hand stdin over to watcher to, empty to gives control back to owner.
+// only the client currently in control could hand off.
+func (t *TerminalSession) handoff(from, to string) {
+	t.mu.Lock()
+	if !t.allowHandoff || t.controller != from || (to != "" && !t.broadcaster.has(to)) {
+		t.mu.Unlock()
+		return
+	}
+	t.controller = to
+	t.mu.Unlock()
+	t.notify(terminal.TerminalMessage{Operation: "control", Data: to})
+}
+
 // Write called from remotecommand whenever there is any output
 func (t *TerminalSession) Write(p []byte) (int, error) {
-	msg, err := json.Marshal(terminal.TerminalMessage{
-		Operation: "stdout",
+	return t.write("stdout", p)
+}
+
+func (t *TerminalSession) write(operation string, p []byte) (int, error) {
+	if t.recorder != nil {
+		t.recorder.Output(p)
+	}
+	msg := terminal.TerminalMessage{
+		Operation: operation,
 		Data:      string(p),
-	})
+	}
+	t.broadcaster.publish(msg)
+	t.stats.Output(len(p))
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	if t.output != nil {
+		// resumable session goes on without owner connection.
+		t.output.write(operation, p)
+		t.sendLocked(msg)
+		return len(p), nil
+	}
+	if err := t.sendLocked(msg); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Exit report exit status of the remote process to owner and watchers.
+// code is terminal.ExitCodeError if the session failed for other reasons, e.g. api error.
+// reason is replaced by why the session was ended if it was ended by server, e.g. timeout.
+func (t *TerminalSession) Exit(code int, reason string) {
+	t.mu.Lock()
+	if t.endReason != "" {
+		reason = t.endReason
+	}
+	t.exitReason = reason
+	t.mu.Unlock()
+	if t.stdout != nil {
+		// output held back for redaction goes before exit.
+		t.stdout.Flush()
+		t.stderr.Flush()
+	}
+	if t.recorder != nil {
+		t.recorder.Marker(fmt.Sprintf("exit %d: %s", code, reason))
+	}
+	t.notify(terminal.TerminalMessage{Operation: "exit", Code: code, Data: reason})
+}
+
+// notify send msg to owner and all watchers.
+func (t *TerminalSession) notify(msg terminal.TerminalMessage) {
+	t.broadcaster.publish(msg)
+	t.send(msg)
+}
+
+// send send msg to owner connection.
+func (t *TerminalSession) send(msg terminal.TerminalMessage) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	return t.sendLocked(msg)
+}
+
+// sendLocked send msg to owner connection, must be called with writeMu held.
+// the connection is closed on failure, so that readLoop notices the disconnection.
+func (t *TerminalSession) sendLocked(msg terminal.TerminalMessage) error {
+	if t.conn == nil {
+		return errDisconnected
+	}
+	messageType, b, err := t.protocol.encode(msg)
 	if err != nil {
 		log.Printf("write parse message err: %v", err)
-		return 0, err
+		return err
 	}
-	t.wsConn.SetWriteDeadline(time.Now().Add(writeWait))
-	if err := t.wsConn.WriteMessage(websocket.TextMessage, msg); err != nil {
+	t.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	if err := t.conn.WriteMessage(messageType, b); err != nil {
 		log.Printf("write message err: %v", err)
-		return 0, err
+		t.conn.Close()
+		return err
 	}
-	return len(p), nil
+	return nil
 }
 
 // Tty ...
@@ -145,10 +478,48 @@ func (t *TerminalSession) Tty() bool {
 	return t.tty
 }
 
-// Close close session
+// SetTty set if the session requests a tty, stdout and stderr are separated without tty.
+// must be called before Start.
+func (t *TerminalSession) SetTty(tty bool) {
+	t.tty = tty
+}
+
+// Close close session, the remote stream is terminated through Context.
 func (t *TerminalSession) Close() error {
-	close(t.doneChan)
-	return t.wsConn.Close()
+	var err error
+	t.closeOnce.Do(func() {
+		terminal.DefaultRegistry.Unregister(t.id)
+		t.end("")
+		t.broadcaster.close()
+		if t.recorder != nil {
+			if err := t.recorder.Close(); err != nil {
+				log.Printf("close recorder err: %v", err)
+			}
+		}
+		t.mu.Lock()
+		reason := t.exitReason
+		if reason == "" {
+			// closed before the remote process exits, e.g. by admin.
+			reason = "session closed"
+		}
+		if t.detachTimer != nil {
+			t.detachTimer.Stop()
+		}
+		t.mu.Unlock()
+		t.writeMu.Lock()
+		defer t.writeMu.Unlock()
+		if t.conn != nil {
+			err = t.dropConn(reason)
+		}
+	})
+	return err
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
 }
 
 func ping(ws *websocket.Conn, done chan struct{}) {
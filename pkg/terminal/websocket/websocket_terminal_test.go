@@ -0,0 +1,392 @@
+package websocket_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/maoqide/kubeutil/pkg/terminal"
+	"github.com/maoqide/kubeutil/pkg/terminal/recorder"
+	wsterminal "github.com/maoqide/kubeutil/pkg/terminal/websocket"
+)
+
+func dial(t *testing.T, url string) *websocket.Conn {
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial %s err: %v", url, err)
+	}
+	return conn
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) terminal.TerminalMessage {
+	var msg terminal.TerminalMessage
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("read message err: %v", err)
+	}
+	return msg
+}
+
+func TestTerminalSessionWatch(t *testing.T) {
+	sessions := make(chan *wsterminal.TerminalSession, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/webshell", func(w http.ResponseWriter, r *http.Request) {
+		pty, err := wsterminal.NewTerminalSession(w, r, nil)
+		if err != nil {
+			t.Errorf("new session err: %v", err)
+			return
+		}
+		pty.Start()
+		sessions <- pty
+	})
+	mux.HandleFunc("/watch/", func(w http.ResponseWriter, r *http.Request) {
+		pty, ok := wsterminal.Lookup(strings.TrimPrefix(r.URL.Path, "/watch/"))
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		pty.AllowHandoff(true)
+		pty.Watch(w, r)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	owner := dial(t, server.URL+"/webshell")
+	defer owner.Close()
+	pty := <-sessions
+	defer pty.Close()
+	if msg := readMessage(t, owner); msg.Operation != "session" || msg.Data != pty.ID() {
+		t.Fatalf("unexpected session message: %+v", msg)
+	}
+
+	pty.Write([]byte("$ "))
+	readMessage(t, owner)
+
+	watcher := dial(t, server.URL+"/watch/"+pty.ID())
+	defer watcher.Close()
+	joined := readMessage(t, watcher)
+	if joined.Operation != "watcher" {
+		t.Fatalf("unexpected watcher message: %+v", joined)
+	}
+	if msg := readMessage(t, watcher); msg.Operation != "stdout" || msg.Data != "$ " {
+		t.Fatalf("unexpected initial screen: %+v", msg)
+	}
+	if msg := readMessage(t, owner); msg.Operation != "watcher" || msg.Data != joined.Data {
+		t.Fatalf("unexpected watcher notification: %+v", msg)
+	}
+
+	owner.WriteJSON(terminal.TerminalMessage{Operation: "handoff", Data: joined.Data})
+	if msg := readMessage(t, watcher); msg.Operation != "control" || msg.Data != joined.Data {
+		t.Fatalf("unexpected control message: %+v", msg)
+	}
+	watcher.WriteJSON(terminal.TerminalMessage{Operation: "stdin", Data: "ls\r"})
+	p := make([]byte, 16)
+	n, err := pty.Read(p)
+	if err != nil || string(p[:n]) != "ls\r" {
+		t.Fatalf("unexpected stdin %q, err: %v", p[:n], err)
+	}
+}
+
+func TestTerminalSessionBinaryProtocol(t *testing.T) {
+	sessions := make(chan *wsterminal.TerminalSession, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pty, err := wsterminal.NewTerminalSession(w, r, nil)
+		if err != nil {
+			t.Errorf("new session err: %v", err)
+			return
+		}
+		pty.Start()
+		sessions <- pty
+	}))
+	defer server.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{wsterminal.BinaryProtocol}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial err: %v", err)
+	}
+	defer conn.Close()
+	if conn.Subprotocol() != wsterminal.BinaryProtocol {
+		t.Fatalf("unexpected subprotocol: %s", conn.Subprotocol())
+	}
+	pty := <-sessions
+	defer pty.Close()
+	// session id on control channel
+	if _, data, err := conn.ReadMessage(); err != nil || data[0] != wsterminal.ControlChannel {
+		t.Fatalf("unexpected session message: %v, err: %v", data, err)
+	}
+
+	// non utf-8 output is kept as is.
+	out := []byte{0xff, 0xfe, 'z'}
+	pty.Write(out)
+	messageType, data, err := conn.ReadMessage()
+	if err != nil || messageType != websocket.BinaryMessage || string(data) != string(append([]byte{wsterminal.StdoutChannel}, out...)) {
+		t.Fatalf("unexpected stdout message: %v, err: %v", data, err)
+	}
+
+	conn.WriteMessage(websocket.BinaryMessage, append([]byte{wsterminal.ResizeChannel}, `{"Width":80,"Height":24}`...))
+	if size := pty.Next(); size == nil || size.Width != 80 || size.Height != 24 {
+		t.Fatalf("unexpected size: %+v", size)
+	}
+	conn.WriteMessage(websocket.BinaryMessage, []byte{wsterminal.StdinChannel, 0x00, 0xff})
+	p := make([]byte, 16)
+	n, err := pty.Read(p)
+	if err != nil || string(p[:n]) != string([]byte{0x00, 0xff}) {
+		t.Fatalf("unexpected stdin %v, err: %v", p[:n], err)
+	}
+}
+
+func TestTerminalSessionExitCode(t *testing.T) {
+	sessions := make(chan *wsterminal.TerminalSession, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pty, err := wsterminal.NewTerminalSession(w, r, nil)
+		if err != nil {
+			t.Errorf("new session err: %v", err)
+			return
+		}
+		pty.Start()
+		sessions <- pty
+	}))
+	defer server.Close()
+
+	conn := dial(t, server.URL)
+	defer conn.Close()
+	pty := <-sessions
+	defer pty.Close()
+	readMessage(t, conn)
+
+	// exit code 0 is sent, clients could tell it from no code.
+	pty.Exit(0, "exited")
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil || !strings.Contains(string(data), `"operation":"exit"`) || !strings.Contains(string(data), `"code":0`) {
+		t.Fatalf("unexpected exit message: %s, err: %v", data, err)
+	}
+}
+
+func TestTerminalSessionNoTtyResize(t *testing.T) {
+	sessions := make(chan *wsterminal.TerminalSession, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pty, err := wsterminal.NewTerminalSession(w, r, nil)
+		if err != nil {
+			t.Errorf("new session err: %v", err)
+			return
+		}
+		pty.SetTty(false)
+		pty.Start()
+		sessions <- pty
+	}))
+	defer server.Close()
+
+	conn := dial(t, server.URL)
+	defer conn.Close()
+	pty := <-sessions
+	defer pty.Close()
+	readMessage(t, conn)
+
+	// nobody calls Next without tty, resize must not block stdin after it.
+	conn.WriteJSON(terminal.TerminalMessage{Operation: "resize", Cols: 80, Rows: 24})
+	conn.WriteJSON(terminal.TerminalMessage{Operation: "stdin", Data: "ls\r"})
+	read := make(chan string, 1)
+	go func() {
+		p := make([]byte, 16)
+		n, _ := pty.Read(p)
+		read <- string(p[:n])
+	}()
+	select {
+	case stdin := <-read:
+		if stdin != "ls\r" {
+			t.Fatalf("unexpected stdin %q", stdin)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stdin blocked by resize")
+	}
+}
+
+func TestTerminalSessionIdleTimeout(t *testing.T) {
+	sessions := make(chan *wsterminal.TerminalSession, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pty, err := wsterminal.NewTerminalSession(w, r, nil)
+		if err != nil {
+			t.Errorf("new session err: %v", err)
+			return
+		}
+		pty.Start()
+		sessions <- pty
+	}))
+	defer server.Close()
+
+	conn := dial(t, server.URL)
+	defer conn.Close()
+	pty := <-sessions
+	defer pty.Close()
+	readMessage(t, conn)
+
+	pty.SetTimeouts(4*time.Second, 0)
+	if msg := readMessage(t, conn); msg.Operation != "warning" || msg.Remaining <= 0 {
+		t.Fatalf("unexpected warning message: %+v", msg)
+	}
+	select {
+	case <-pty.Context().Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("session not ended after idle timeout")
+	}
+	if pty.Next() != nil {
+		t.Fatal("expected no more resize after session ended")
+	}
+	if pty.EndReason() == "" {
+		t.Fatal("expected end reason")
+	}
+}
+
+func TestTerminalSessionResume(t *testing.T) {
+	sessions := make(chan *wsterminal.TerminalSession, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/webshell", func(w http.ResponseWriter, r *http.Request) {
+		pty, err := wsterminal.NewTerminalSession(w, r, nil)
+		if err != nil {
+			t.Errorf("new session err: %v", err)
+			return
+		}
+		pty.SetResumable(time.Minute)
+		pty.Start()
+		sessions <- pty
+	})
+	mux.HandleFunc("/resume/", func(w http.ResponseWriter, r *http.Request) {
+		pty, ok := wsterminal.Lookup(strings.TrimPrefix(r.URL.Path, "/resume/"))
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		offset, _ := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+		pty.Resume(w, r, r.URL.Query().Get("token"), offset)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	owner := dial(t, server.URL+"/webshell")
+	pty := <-sessions
+	defer pty.Close()
+	readMessage(t, owner)
+	token := readMessage(t, owner)
+	if token.Operation != "token" || token.Data == "" {
+		t.Fatalf("unexpected token message: %+v", token)
+	}
+	pty.Write([]byte("abc"))
+	readMessage(t, owner)
+	// drop the connection without closing handshake, output goes on meanwhile.
+	owner.Close()
+	pty.Write([]byte("def"))
+	pty.Stderr().Write([]byte("ghi"))
+
+	if _, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/resume/"+pty.ID()+"?token=wrong", nil); err == nil {
+		t.Fatal("expected resume with wrong token to fail")
+	}
+	resumed := dial(t, server.URL+"/resume/"+pty.ID()+"?offset=3&token="+token.Data)
+	defer resumed.Close()
+	if msg := readMessage(t, resumed); msg.Operation != "session" || msg.Data != pty.ID() {
+		t.Fatalf("unexpected session message: %+v", msg)
+	}
+	if msg := readMessage(t, resumed); msg.Operation != "stdout" || msg.Data != "def" {
+		t.Fatalf("unexpected missed output: %+v", msg)
+	}
+	if msg := readMessage(t, resumed); msg.Operation != "stderr" || msg.Data != "ghi" {
+		t.Fatalf("unexpected missed stderr: %+v", msg)
+	}
+	resumed.WriteJSON(terminal.TerminalMessage{Operation: "stdin", Data: "ls\r"})
+	p := make([]byte, 16)
+	n, err := pty.Read(p)
+	if err != nil || string(p[:n]) != "ls\r" {
+		t.Fatalf("unexpected stdin %q, err: %v", p[:n], err)
+	}
+}
+
+func TestTerminalSessionCleanClose(t *testing.T) {
+	sessions := make(chan *wsterminal.TerminalSession, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pty, err := wsterminal.NewTerminalSession(w, r, nil)
+		if err != nil {
+			t.Errorf("new session err: %v", err)
+			return
+		}
+		pty.SetResumable(time.Minute)
+		pty.Start()
+		sessions <- pty
+	}))
+	defer server.Close()
+
+	for _, closeConn := range []func(conn *websocket.Conn){
+		func(conn *websocket.Conn) {
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		},
+		func(conn *websocket.Conn) {
+			conn.WriteJSON(terminal.TerminalMessage{Operation: "close"})
+		},
+	} {
+		conn := dial(t, server.URL)
+		pty := <-sessions
+		readMessage(t, conn)
+		// resumable session does not wait for client closed on purpose.
+		closeConn(conn)
+		select {
+		case <-pty.Context().Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("session not ended after client closed")
+		}
+		pty.Close()
+		conn.Close()
+	}
+}
+
+// bufferSink records to a buffer.
+type bufferSink struct {
+	bytes.Buffer
+}
+
+func (s *bufferSink) Create(meta recorder.Meta) (io.WriteCloser, error) {
+	return s, nil
+}
+
+func (s *bufferSink) Close() error {
+	return nil
+}
+
+func TestTerminalSessionRecordFirstResize(t *testing.T) {
+	sink := &bufferSink{}
+	sessions := make(chan *wsterminal.TerminalSession, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pty, err := wsterminal.NewTerminalSession(w, r, nil)
+		if err != nil {
+			t.Errorf("new session err: %v", err)
+			return
+		}
+		sessions <- pty
+	}))
+	defer server.Close()
+
+	conn := dial(t, server.URL)
+	defer conn.Close()
+	// client resizes right after connected, before the session is configured.
+	conn.WriteJSON(terminal.TerminalMessage{Operation: "resize", Cols: 120, Rows: 40})
+	pty := <-sessions
+	rec, err := recorder.New(sink, recorder.Meta{SessionID: pty.ID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pty.SetRecorder(rec)
+	pty.Start()
+	if size := pty.Next(); size == nil || size.Width != 120 {
+		t.Fatalf("unexpected size: %+v", size)
+	}
+	pty.Close()
+	if !strings.Contains(sink.String(), `"r","120x40"`) {
+		t.Fatalf("first resize not recorded: %s", sink.String())
+	}
+}
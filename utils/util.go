@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"io/ioutil"
 	"log"
@@ -31,6 +33,11 @@ func Int64Ptr(i int64) *int64 {
 	return &i
 }
 
+// BoolPtr convert bool value to a pointer.
+func BoolPtr(b bool) *bool {
+	return &b
+}
+
 // StringPtr convert string value to a pointer.
 func StringPtr(s string) *string {
 	return &s
@@ -86,3 +93,12 @@ func Env(key, defaultVal string) string {
 	}
 	return defaultVal
 }
+
+// NewID generate a random hex encoded id.
+func NewID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}